@@ -3,70 +3,140 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"gg/src/cli"
 	"gg/src/diff"
 	"gg/src/io"
+	"gg/src/loader"
 	"gg/src/models"
+	"gg/src/repo"
+	"gg/src/utils"
 	"gg/src/views"
 	"gg/src/watcher"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-// processDiffLines processes diff lines and untracked files, returns files, message, view mode, and diff type
-func processDiffLines(lines []string, untrackedFiles []string, diffType string) ([]models.FileDiff, string, string, string) {
-	var files []models.FileDiff
-	var noDiffMessage string
-	var viewMode string
+// defaultDiffType picks the diff type to show first: unstaged changes, falling back to staged ones
+func defaultDiffType(unstaged, staged []models.FileDiff) string {
+	if len(unstaged) == 0 && len(staged) > 0 {
+		return "staged"
+	}
+	return "unstaged"
+}
 
-	// Parse tracked diff files
-	if len(lines) > 0 {
-		files = diff.ParseDiffIntoFiles(lines)
+func main() {
+	opts, err := cli.Parse(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n%s\n", err, cli.Usage)
+		os.Exit(2)
+	}
+	if opts.ShowHelp {
+		fmt.Println(cli.Usage)
+		return
 	}
+	utils.TabWidth = opts.TabWidth
 
-	// Add untracked files
-	if len(untrackedFiles) > 0 {
-		untrackedDiffs := diff.CreateUntrackedFileDiffs(untrackedFiles)
-		files = append(files, untrackedDiffs...)
+	if opts.PatchFile != "" {
+		runPatch(opts)
+		return
+	}
+	if opts.NoIndex {
+		runNoIndex(opts)
+		return
 	}
 
-	// Determine view mode and message
-	if len(files) == 0 {
-		noDiffMessage = "No changes to display"
-		viewMode = "log" // Default to log view when no diff
-		diffType = "none"
+	// Locate the repository once; everything below works relative to its root
+	ctx, err := repo.Discover()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts.Paths = ctx.ResolvePathspecs(opts.Paths)
+
+	// Validate and label the requested revision range up front
+	rangeLabel, err := io.ResolveRange(ctx, opts.Revisions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The diff is read in the background (see appWrapper.Init) so the UI comes up right away
+	m := models.Model{
+		Repo:             ctx,
+		ViewMode:         "diff",
+		Range:            rangeLabel,
+		Pathspecs:        opts.Paths,
+		ExpandSubmodules: opts.RecurseSubmodules,
+		UnifiedWidth:     opts.UnifiedWidth,
+		Loading:          true,
+		RepoState:        ctx.State(),
+		// Auto-reload is only useful while the working tree is being compared
+		AutoReloadEnabled: opts.Revisions.IncludesWorkingTree(),
+	}
+	if rangeLabel != "" {
+		m.SelectDiffType("range")
 	} else {
-		viewMode = "diff" // Show diff view when there are files
+		m.SelectDiffType("unstaged")
 	}
 
-	return files, noDiffMessage, viewMode, diffType
+	p := tea.NewProgram(&appWrapper{Model: m, opts: opts}, tea.WithAltScreen())
+	if _, err := p.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 }
 
-func main() {
-	lines, diffType, err := io.ReadDiff()
+// runPatch shows a patch file (or stdin) without touching the repository
+// Auto-reload and the log view are disabled since a patch never changes
+func runPatch(opts cli.Options) {
+	lines, err := io.ReadPatch(opts.PatchFile)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	untrackedFiles, err := io.ReadUntrackedFiles()
-	if err != nil {
+	m := models.Model{
+		AllFiles:     diff.ParsePatch(lines),
+		ViewMode:     "diff",
+		PatchSource:  opts.PatchFile,
+		UnifiedWidth: opts.UnifiedWidth,
+	}
+	m.SelectDiffType("patch")
+
+	programOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	if opts.PatchFile == "-" {
+		// Stdin carries the patch, so read keys from the terminal instead
+		programOpts = append(programOpts, tea.WithInputTTY())
+	}
+
+	p := tea.NewProgram(&appWrapper{Model: m, opts: opts}, programOpts...)
+	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	files, noDiffMessage, viewMode, diffType := processDiffLines(lines, untrackedFiles, diffType)
+// runNoIndex compares two files or directories outside of any git repository
+func runNoIndex(opts cli.Options) {
+	oldPath, newPath := opts.NoIndexPaths[0], opts.NoIndexPaths[1]
+	entries, err := io.ReadNoIndex(oldPath, newPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	m := models.Model{
-		Files:             files,
-		ActiveTab:         0,
-		ViewMode:          viewMode,
-		NoDiffMessage:     noDiffMessage,
-		DiffType:          diffType,
-		AutoReloadEnabled: true, // Enable auto-reload by default
+		AllFiles:     diff.CreateNoIndexFileDiffs(entries),
+		ViewMode:     "diff",
+		NoIndex:      oldPath + ".." + newPath,
+		UnifiedWidth: opts.UnifiedWidth,
 	}
+	m.SelectDiffType("noindex")
 
-	p := tea.NewProgram(&appWrapper{Model: m}, tea.WithAltScreen())
+	p := tea.NewProgram(&appWrapper{Model: m, opts: opts}, tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -75,43 +145,185 @@ func main() {
 
 // RefreshDataMsg contains refreshed git diff data
 type RefreshDataMsg struct {
-	Files         []models.FileDiff
+	UnstagedFiles []models.FileDiff
+	StagedFiles   []models.FileDiff
+	AllFiles      []models.FileDiff
 	NoDiffMessage string
-	ViewMode      string
-	DiffType      string
+	Paths         []string // Paths re-diffed by an incremental refresh, nil when everything was reloaded
 }
 
-// refreshDiffData reads git diff and untracked files, then returns RefreshDataMsg
-func refreshDiffData() tea.Msg {
-	lines, diffType, err := io.ReadDiff()
-	if err != nil {
-		// On error, return empty data
+// refreshDiffData returns a command that reads git diff and untracked files for the given options
+func refreshDiffData(ctx *repo.Context, opts cli.Options) tea.Cmd {
+	return func() tea.Msg {
+		done := loader.Load(ctx, opts)
+		if done.Err != nil {
+			// On error, return empty data
+			return RefreshDataMsg{NoDiffMessage: "Error reading diff"}
+		}
+
 		return RefreshDataMsg{
-			Files:         []models.FileDiff{},
-			NoDiffMessage: "Error reading diff",
-			ViewMode:      "log",
-			DiffType:      "none",
+			UnstagedFiles: done.UnstagedFiles,
+			StagedFiles:   done.StagedFiles,
+			AllFiles:      done.AllFiles,
 		}
 	}
+}
+
+// refreshPaths returns a command that re-diffs only the given paths, to be merged into the loaded sets
+func refreshPaths(ctx *repo.Context, opts cli.Options, paths []string) tea.Cmd {
+	return func() tea.Msg {
+		done := loader.LoadPaths(ctx, opts, paths)
+		if done.Err != nil {
+			// Let a full reload report the error
+			return refreshDiffData(ctx, opts)()
+		}
 
-	untrackedFiles, err := io.ReadUntrackedFiles()
-	if err != nil {
-		// On error, return empty data
 		return RefreshDataMsg{
-			Files:         []models.FileDiff{},
-			NoDiffMessage: "Error reading untracked files",
-			ViewMode:      "log",
-			DiffType:      "none",
+			UnstagedFiles: done.UnstagedFiles,
+			AllFiles:      done.AllFiles,
+			Paths:         paths,
+		}
+	}
+}
+
+// IndexUpdatedMsg reports the result of a git command run to change the index or working tree, such as staging a hunk
+type IndexUpdatedMsg struct {
+	Notice string // What was done, shown when the command succeeded
+	Err    error
+}
+
+// resolveConflict returns a command that writes an unmerged file's resolution and marks it resolved
+func resolveConflict(ctx *repo.Context, msg models.ResolveConflictMsg) tea.Cmd {
+	return func() tea.Msg {
+		err := io.ResolvePath(ctx, msg.Path, []byte(msg.Content))
+		return IndexUpdatedMsg{Notice: "Resolved " + msg.Path, Err: err}
+	}
+}
+
+// stageLines returns a command that applies the selected lines to the index, or takes them back out when unstaging
+func stageLines(ctx *repo.Context, msg models.StageLinesMsg) tea.Cmd {
+	return func() tea.Msg {
+		action := "Staged"
+		if msg.Unstage {
+			action = "Unstaged"
+		}
+		notice := fmt.Sprintf("%s %s of %s", action, msg.What, msg.File.Name)
+		patch := diff.LinesPatch(&msg.File, msg.Lines, msg.Unstage)
+
+		if msg.File.Status == "Untracked" {
+			return IndexUpdatedMsg{Notice: notice, Err: stageUntracked(ctx, &msg.File, msg.Lines, patch)}
+		}
+		return IndexUpdatedMsg{Notice: notice, Err: io.ApplyToIndex(ctx, patch, msg.Unstage)}
+	}
+}
+
+// stageUntracked stages the selected lines of an untracked file, which has no index entry to patch yet
+// The whole file is added as-is; part of it is patched onto an intent-to-add entry, removed again if that fails
+func stageUntracked(ctx *repo.Context, file *models.FileDiff, lines map[models.LineRef]bool, patch string) error {
+	if diff.SelectsAll(file, lines) {
+		return io.StagePaths(ctx, file.Name)
+	}
+	if err := io.IntentToAdd(ctx, file.Name); err != nil {
+		return err
+	}
+	if err := io.ApplyToIndex(ctx, patch, false); err != nil {
+		io.RemoveFromIndex(ctx, file.Name)
+		return err
+	}
+	return nil
+}
+
+// runFileAction returns a command that runs a batch action from the stats table on its files
+func runFileAction(ctx *repo.Context, msg models.FileActionMsg) tea.Cmd {
+	return func() tea.Msg {
+		var err error
+		var done string
+		switch msg.Action {
+		case "stage":
+			done, err = "Staged", io.StagePaths(ctx, msg.Paths...)
+		case "unstage":
+			done, err = "Unstaged", io.UnstagePaths(ctx, msg.Paths...)
+		case "discard":
+			done, err = "Discarded changes to", discardPaths(ctx, msg, io.DiscardPaths)
+		case "delete":
+			done, err = "Deleted", discardPaths(ctx, msg, io.DeleteUntracked)
+		case "ignore":
+			done, err = "Ignored", io.IgnorePaths(ctx, msg.Paths...)
 		}
+
+		notice := fmt.Sprintf("%s %d files", done, len(msg.Paths))
+		if len(msg.Paths) == 1 {
+			notice = done + " " + msg.Paths[0]
+		}
+		if msg.Skipped > 0 {
+			notice += fmt.Sprintf(" (%d skipped)", msg.Skipped)
+		}
+		if msg.Destructive() {
+			notice += ", z to undo"
+		}
+		return IndexUpdatedMsg{Notice: notice, Err: err}
 	}
+}
 
-	files, noDiffMessage, viewMode, diffType := processDiffLines(lines, untrackedFiles, diffType)
+// discardPaths saves the content of the paths to the trash before discarding them, and leaves them alone if it can't
+func discardPaths(ctx *repo.Context, msg models.FileActionMsg, discard func(*repo.Context, ...string) error) error {
+	if err := io.SaveToTrash(ctx, msg.Describe(), msg.Paths...); err != nil {
+		return err
+	}
+	return discard(ctx, msg.Paths...)
+}
 
-	return RefreshDataMsg{
-		Files:         files,
-		NoDiffMessage: noDiffMessage,
-		ViewMode:      viewMode,
-		DiffType:      diffType,
+// loadTrash returns a command that reads the saved discards for the trash browser
+func loadTrash(ctx *repo.Context) tea.Cmd {
+	return func() tea.Msg {
+		entries, err := io.ListTrash(ctx)
+		return models.TrashLoadedMsg{Entries: entries, Err: err}
+	}
+}
+
+// restoreTrash returns a command that puts a saved discard back in the working tree, the most recent one if entry is nil
+func restoreTrash(ctx *repo.Context, entry *io.TrashEntry) tea.Cmd {
+	return func() tea.Msg {
+		if entry == nil {
+			entries, err := io.ListTrash(ctx)
+			if err != nil {
+				return IndexUpdatedMsg{Err: err}
+			}
+			if len(entries) == 0 {
+				return IndexUpdatedMsg{Notice: "No discarded changes to restore"}
+			}
+			entry = &entries[0]
+		}
+		return IndexUpdatedMsg{Notice: "Restored: " + entry.Summary, Err: io.RestoreTrash(ctx, *entry)}
+	}
+}
+
+// busyLabels describe the batch actions while they run
+var busyLabels = map[string]string{
+	"stage": "Staging", "unstage": "Unstaging", "discard": "Discarding", "delete": "Deleting", "ignore": "Ignoring",
+}
+
+// loadLastMessage returns a command that reads the last commit's message for amending
+func loadLastMessage(ctx *repo.Context) tea.Cmd {
+	return func() tea.Msg {
+		message, err := io.LastCommitMessage(ctx)
+		return models.LastMessageMsg{Message: message, Err: err}
+	}
+}
+
+// loadStaged returns a command that reads the staged files for the composer
+func loadStaged(ctx *repo.Context) tea.Cmd {
+	return func() tea.Msg {
+		files, err := io.ReadStaged(ctx)
+		return models.StagedLoadedMsg{Files: files, Err: err}
+	}
+}
+
+// runCommit returns a command that commits the staged changes with the composed message
+func runCommit(ctx *repo.Context, msg models.CommitMsg) tea.Cmd {
+	return func() tea.Msg {
+		output, err := io.Commit(ctx, msg.Message, msg.Options)
+		return models.CommitDoneMsg{Output: output, Err: err}
 	}
 }
 
@@ -119,47 +331,93 @@ func refreshDiffData() tea.Msg {
 // This avoids circular imports between models and views packages
 type appWrapper struct {
 	models.Model
+	opts           cli.Options // Command line options, reused on refresh
 	logTableInit   bool
 	statsTableInit bool
+	watcher        *watcher.Watcher      // Long-lived file watcher, nil when it couldn't be started
+	refreshing     bool                  // A refresh is running; further changes wait in queued
+	queued         *watcher.GitChangeMsg // Changes not yet refreshed, coalesced
 }
 
 func (a *appWrapper) Init() tea.Cmd {
-	// Start both model init and watcher
-	return tea.Batch(
-		a.Model.Init(),
-		watcher.WatchGitChanges(),
-	)
+	// Patches and path comparisons have no repository to watch
+	if !a.HasRepository() {
+		return a.Model.Init()
+	}
+
+	// Start model init, the background diff load and the watcher
+	cmds := []tea.Cmd{a.Model.Init(), loader.Start(a.Repo, a.opts)}
+	if w, err := watcher.Start(a.Repo, a.opts.Paths, a.opts.WatchBackend, a.opts.PollInterval); err == nil {
+		// If we can't create the watcher the app continues without auto-reload
+		a.watcher = w
+		a.WatchBackend = w.Backend()
+		cmds = append(cmds, w.Wait())
+	}
+	return tea.Batch(cmds...)
 }
 
 func (a *appWrapper) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Handle git change messages before passing to model
 	switch msg := msg.(type) {
 	case watcher.GitChangeMsg:
-		// Only trigger refresh if auto-reload is enabled
+		// The watcher may have switched to polling
+		a.WatchBackend = msg.Backend
+		if msg.Full {
+			// Git state changed, possibly starting or ending a merge, rebase, ...
+			a.updateRepoState()
+		}
+
+		// Only refresh if auto-reload is enabled; keep receiving changes either way
 		if a.AutoReloadEnabled {
-			// Trigger refresh and restart watcher
-			// Use Sequence to ensure refresh completes before watcher restarts
-			// This forces Bubble Tea to render immediately
-			return a, tea.Sequence(
-				tea.Cmd(refreshDiffData),
-				watcher.WatchGitChanges(),
-			)
-		} else {
-			// Just restart watcher without refreshing
-			return a, watcher.WatchGitChanges()
+			a.queueRefresh(msg)
+			return a, tea.Batch(a.startRefresh(), a.watcher.Wait())
 		}
+		return a, a.watcher.Wait()
 
 	case RefreshDataMsg:
-		// Update model with refreshed data
-		a.Files = msg.Files
-		a.NoDiffMessage = msg.NoDiffMessage
-		a.DiffType = msg.DiffType
-		// Don't change ViewMode - keep user in their current view
-		a.ActiveTab = 0 // Reset to first tab
+		a.refreshing = false
+		activeName := ""
+		if a.ActiveTab < len(a.Files) {
+			activeName = a.Files[a.ActiveTab].Name
+		}
+		offset := a.LeftViewport.YOffset
+
+		if msg.Paths != nil {
+			// Swap in the re-diffed paths, leaving every other file and its highlight cache alone
+			a.UnstagedFiles = loader.Merge(a.UnstagedFiles, msg.UnstagedFiles, msg.Paths)
+			a.AllFiles = loader.Merge(a.AllFiles, msg.AllFiles, msg.Paths)
+			diff.MarkStages(a.UnstagedFiles, a.StagedFiles, a.AllFiles)
+		} else {
+			loader.KeepHighlighting(a.UnstagedFiles, msg.UnstagedFiles)
+			loader.KeepHighlighting(a.StagedFiles, msg.StagedFiles)
+			loader.KeepHighlighting(a.AllFiles, msg.AllFiles)
+			a.UnstagedFiles = msg.UnstagedFiles
+			a.StagedFiles = msg.StagedFiles
+			a.AllFiles = msg.AllFiles
+		}
+
+		// Keep the user's view, diff type and file, and the scroll position within it
+		a.SyncFiles()
+		sameFile := false
+		for i, file := range a.Files {
+			if file.Name == activeName {
+				a.ActiveTab = i
+				sameFile = true
+				break
+			}
+		}
+		if msg.NoDiffMessage != "" {
+			a.NoDiffMessage = msg.NoDiffMessage
+		}
 
 		// Reinitialize all views with new data
 		if a.ViewMode == "diff" {
 			views.UpdateContent(&a.Model)
+			if sameFile {
+				a.LeftViewport.SetYOffset(offset)
+				a.RightViewport.YOffset = a.LeftViewport.YOffset
+			}
+			a.DiffSearch.CurrentMatch = max(min(a.DiffSearch.CurrentMatch, len(a.DiffSearch.Matches)-1), 0)
 		}
 
 		// Reinitialize tables with new data
@@ -171,6 +429,148 @@ func (a *appWrapper) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		views.UpdateLogContent(&a.Model)
 		a.logTableInit = true
 
+		// Changes made during this refresh come next
+		if a.Composer.Open {
+			// The index may have changed too
+			return a, tea.Batch(a.startRefresh(), loadStaged(a.Repo))
+		}
+		return a, a.startRefresh()
+
+	case loader.ProgressMsg:
+		// Files parsed so far; show them while the rest of the diff loads
+		switch msg.Set {
+		case "unstaged":
+			a.UnstagedFiles = append(a.UnstagedFiles, msg.Files...)
+		case "staged":
+			a.StagedFiles = append(a.StagedFiles, msg.Files...)
+		default:
+			a.AllFiles = append(a.AllFiles, msg.Files...)
+		}
+		a.SyncFiles()
+		a.updateFileViews()
+		return a, msg.Next()
+
+	case loader.DoneMsg:
+		// Replace the progressively built sets with the final ones, which also carry stage markers
+		a.Loading = false
+		a.UnstagedFiles = msg.UnstagedFiles
+		a.StagedFiles = msg.StagedFiles
+		a.AllFiles = msg.AllFiles
+
+		// Fall back to staged changes when there is nothing unstaged
+		if a.Range == "" && a.DiffType == "unstaged" {
+			a.DiffType = defaultDiffType(a.UnstagedFiles, a.StagedFiles)
+		}
+		a.SyncFiles()
+
+		if msg.Err != nil {
+			a.NoDiffMessage = "Error reading diff: " + msg.Err.Error()
+		} else if !a.HasChanges() && a.ViewMode == "diff" {
+			// Default to log view when there is nothing to diff
+			a.ViewMode = "log"
+			a.ViewChanged = true
+			a.NoDiffMessage = "No changes to display"
+		}
+
+		a.updateFileViews()
+		if a.ViewMode == "log" {
+			views.UpdateLogContent(&a.Model)
+			a.logTableInit = true
+			a.ViewChanged = false
+		}
+		// Changes made while loading come next
+		return a, a.startRefresh()
+
+	case models.SubmodulesToggledMsg:
+		// Reload with or without the submodules' nested file diffs
+		a.opts.RecurseSubmodules = a.ExpandSubmodules
+		a.queueRefresh(watcher.GitChangeMsg{Full: true})
+		return a, a.startRefresh()
+
+	case models.ResolveConflictMsg:
+		// Write the resolved file and stage it in the background
+		return a, resolveConflict(a.Repo, msg)
+
+	case models.StageLinesMsg:
+		return a, stageLines(a.Repo, msg)
+
+	case models.FileActionMsg:
+		// Batch actions can take a while on many files; a spinner runs in the banner meanwhile
+		a.Busy = fmt.Sprintf("%s %d files", busyLabels[msg.Action], len(msg.Paths))
+		a.Spinner = spinner.New(spinner.WithSpinner(spinner.MiniDot))
+		a.ResizeViewports()
+		return a, tea.Batch(runFileAction(a.Repo, msg), a.Spinner.Tick)
+
+	case models.OpenTrashMsg:
+		return a, loadTrash(a.Repo)
+
+	case models.RestoreTrashMsg:
+		a.Busy = "Restoring"
+		a.Spinner = spinner.New(spinner.WithSpinner(spinner.MiniDot))
+		a.ResizeViewports()
+		return a, tea.Batch(restoreTrash(a.Repo, msg.Entry), a.Spinner.Tick)
+
+	case models.LoadLastMessageMsg:
+		return a, loadLastMessage(a.Repo)
+
+	case models.LoadStagedMsg:
+		return a, loadStaged(a.Repo)
+
+	case models.CommitMsg:
+		// Hooks can take a while; a spinner runs in the banner meanwhile
+		a.Busy = "Committing"
+		a.Spinner = spinner.New(spinner.WithSpinner(spinner.MiniDot))
+		a.ResizeViewports()
+		return a, tea.Batch(runCommit(a.Repo, msg), a.Spinner.Tick)
+
+	case models.CommitDoneMsg:
+		a.Busy = ""
+		if msg.Err != nil {
+			a.Notice = "Commit failed, see the output of git commit"
+		} else {
+			a.Notice = "Committed"
+			// git sums up the commit as "[branch hash] subject", after anything the hooks printed
+			for _, line := range strings.Split(msg.Output, "\n") {
+				if strings.HasPrefix(line, "[") {
+					a.Notice = "Committed " + line
+					break
+				}
+			}
+		}
+		a.FinishCommit(msg)
+		a.ResizeViewports()
+		// A commit moves HEAD, may end a merge and empties the index
+		a.updateRepoState()
+		views.UpdateLogContent(&a.Model)
+		a.logTableInit = true
+		a.queueRefresh(watcher.GitChangeMsg{Full: true})
+		return a, a.startRefresh()
+
+	case spinner.TickMsg:
+		// Stop ticking once the command is done
+		if a.Busy == "" {
+			return a, nil
+		}
+		var cmd tea.Cmd
+		a.Spinner, cmd = a.Spinner.Update(msg)
+		return a, cmd
+
+	case IndexUpdatedMsg:
+		a.Busy = ""
+		if msg.Err != nil {
+			a.Notice = msg.Err.Error()
+		} else {
+			a.Notice = msg.Notice
+		}
+		a.ResizeViewports()
+		a.updateFileViews()
+		// Reload everything, as the index is shared by the unstaged and staged sets
+		a.queueRefresh(watcher.GitChangeMsg{Full: true})
+		return a, a.startRefresh()
+
+	case models.DiffTypeChangedMsg:
+		// Diff type switched, rebuild the views showing the file set
+		a.updateFileViews()
 		return a, nil
 
 	case models.FilterAppliedMsg:
@@ -200,16 +600,76 @@ func (a *appWrapper) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	} else if a.ViewMode == "stats" {
 		// Only initialize stats table once and only if there are files to display
-		if !a.statsTableInit && len(a.Files) > 0 {
+		// Rebuild it when the view changed, e.g. a file was picked
+		if (!a.statsTableInit || a.Model.ViewChanged) && len(a.Files) > 0 {
 			views.UpdateStatsContent(&a.Model)
 			a.statsTableInit = true
+			a.Model.ViewChanged = false
 		}
 	}
 
 	return a, cmd
 }
 
+// queueRefresh adds changes to the pending refresh
+func (a *appWrapper) queueRefresh(change watcher.GitChangeMsg) {
+	if a.queued == nil {
+		a.queued = &watcher.GitChangeMsg{}
+	}
+	a.queued.Full = a.queued.Full || change.Full
+	a.queued.Paths = append(a.queued.Paths, change.Paths...)
+}
+
+// startRefresh runs the pending refresh unless a load or another refresh is still running,
+// so results are applied in order. Only the changed paths are re-diffed when that's enough
+func (a *appWrapper) startRefresh() tea.Cmd {
+	if a.queued == nil || a.Loading || a.refreshing {
+		return nil
+	}
+	change := *a.queued
+	a.queued = nil
+	a.refreshing = true
+
+	if change.Full || !loader.CanMerge(change.Paths, a.UnstagedFiles, a.AllFiles) {
+		return refreshDiffData(a.Repo, a.opts)
+	}
+	return refreshPaths(a.Repo, a.opts, change.Paths)
+}
+
+// updateRepoState rereads the operation in progress, resizing the views when its banner appears or goes
+func (a *appWrapper) updateRepoState() {
+	state := a.Repo.State()
+	if state == a.RepoState {
+		return
+	}
+	a.RepoState = state
+	a.ResizeViewports()
+	a.updateFileViews()
+	views.UpdateLogContent(&a.Model)
+	a.logTableInit = true
+}
+
+// updateFileViews rebuilds the stats table and diff content after the file set changed
+func (a *appWrapper) updateFileViews() {
+	if len(a.Files) > 0 {
+		views.UpdateStatsContent(&a.Model)
+		a.statsTableInit = true
+	} else {
+		a.statsTableInit = false
+	}
+	if a.ViewMode == "diff" {
+		views.UpdateContent(&a.Model)
+	}
+}
+
 func (a *appWrapper) View() string {
+	// The commit screen and trash browser cover whichever view is open
+	if a.Composer.Open {
+		return views.RenderComposerView(&a.Model)
+	}
+	if a.Trash.Open {
+		return views.RenderTrashView(&a.Model)
+	}
 	switch a.ViewMode {
 	case "stats":
 		return views.RenderStatsView(&a.Model)
@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"gg/src/io"
+)
+
+// Usage is printed for --help and on argument errors
+const Usage = `usage: gg [--cached] [--recurse-submodules] [--unified-width=<cols>] [--tab-width=<cols>]
+          [--watch=<backend>] [--poll-interval=<duration>] [<commit> [<commit>]] [-- <path>...]
+       gg <commit>..<commit> [-- <path>...]
+       gg <commit>...<commit> [-- <path>...]
+       gg <patch-file>
+       gg -
+       gg --no-index <path> <path>
+
+With no arguments gg shows unstaged, staged and all working tree changes.
+Revision arguments follow the same syntax as git diff.
+Paths after -- limit the diff, log and file watching to matching files.
+--recurse-submodules also shows the files changed inside submodules.
+A patch file, or - to read a patch from stdin, is shown without touching
+the repository; git format-patch mailboxes are supported. A file that isn't
+a patch is read as a path, like git diff <path>.
+--no-index compares two files or directories, inside or outside a repository.
+--unified-width shows a single-column diff on terminals narrower than <cols>
+(default 120, 0 to always start side by side); press v to switch layouts.
+--tab-width sets the spacing of tab stops in displayed text (default 4).
+--watch picks how changes are detected for auto-reload: fsnotify, poll, or
+auto (default) to use file system notifications and fall back to polling
+when they are unavailable or the watch limit is reached.
+--poll-interval sets how often polling checks the repository (default 2s).`
+
+// DefaultUnifiedWidth is the terminal width below which the unified layout is used
+const DefaultUnifiedWidth = 120
+
+// DefaultTabWidth is the spacing of tab stops when tabs are expanded for display
+const DefaultTabWidth = 4
+
+// DefaultPollInterval is how often the polling watcher checks the repository
+const DefaultPollInterval = 2 * time.Second
+
+// Options holds everything configured from the command line
+type Options struct {
+	Revisions         io.Revisions  // What the diff compares
+	Paths             []string      // Pathspecs after "--" scoping every view
+	PatchFile         string        // Patch to display instead of running git diff ("-" for stdin)
+	NoIndex           bool          // Compare two paths outside git (--no-index)
+	NoIndexPaths      []string      // The old and new paths compared with --no-index
+	RecurseSubmodules bool          // Add submodules' own file diffs as tabs
+	UnifiedWidth      int           // Terminal width below which the diff is shown unified
+	TabWidth          int           // Spacing of tab stops in displayed text
+	WatchBackend      string        // How changes are detected: "auto", "fsnotify" or "poll"
+	PollInterval      time.Duration // Time between checks when polling
+	ShowHelp          bool          // Print usage and exit
+}
+
+// Parse parses command line arguments (without the program name) into Options
+func Parse(args []string) (Options, error) {
+	opts := Options{
+		UnifiedWidth: DefaultUnifiedWidth,
+		TabWidth:     DefaultTabWidth,
+		WatchBackend: "auto",
+		PollInterval: DefaultPollInterval,
+	}
+
+	for i, arg := range args {
+		if arg == "--" {
+			// Everything after -- is a pathspec
+			opts.Paths = append(opts.Paths, args[i+1:]...)
+			break
+		}
+
+		switch {
+		case arg == "-h" || arg == "--help":
+			opts.ShowHelp = true
+		case arg == "--cached" || arg == "--staged":
+			opts.Revisions.Cached = true
+		case arg == "--no-index":
+			opts.NoIndex = true
+		case arg == "--recurse-submodules":
+			opts.RecurseSubmodules = true
+		case strings.HasPrefix(arg, "--unified-width="):
+			width, err := strconv.Atoi(strings.TrimPrefix(arg, "--unified-width="))
+			if err != nil || width < 0 {
+				return Options{}, fmt.Errorf("invalid --unified-width: %s", arg)
+			}
+			opts.UnifiedWidth = width
+		case strings.HasPrefix(arg, "--tab-width="):
+			width, err := strconv.Atoi(strings.TrimPrefix(arg, "--tab-width="))
+			if err != nil || width < 1 {
+				return Options{}, fmt.Errorf("invalid --tab-width: %s", arg)
+			}
+			opts.TabWidth = width
+		case strings.HasPrefix(arg, "--watch="):
+			backend := strings.TrimPrefix(arg, "--watch=")
+			if backend != "auto" && backend != "fsnotify" && backend != "poll" {
+				return Options{}, fmt.Errorf("invalid --watch: %s (expected auto, fsnotify or poll)", arg)
+			}
+			opts.WatchBackend = backend
+		case strings.HasPrefix(arg, "--poll-interval="):
+			interval, err := time.ParseDuration(strings.TrimPrefix(arg, "--poll-interval="))
+			if err != nil || interval <= 0 {
+				return Options{}, fmt.Errorf("invalid --poll-interval: %s", arg)
+			}
+			opts.PollInterval = interval
+		case arg == "-":
+			opts.PatchFile = "-"
+		case strings.HasPrefix(arg, "-"):
+			return Options{}, fmt.Errorf("unknown option: %s", arg)
+		default:
+			opts.Revisions.Args = append(opts.Revisions.Args, arg)
+		}
+	}
+
+	// --no-index takes exactly two paths instead of revisions
+	if opts.NoIndex {
+		paths := append(opts.Revisions.Args, opts.Paths...)
+		if len(paths) != 2 || opts.Revisions.Cached || opts.PatchFile != "" {
+			return Options{}, fmt.Errorf("--no-index requires exactly two paths")
+		}
+		opts.NoIndexPaths = paths
+		opts.Revisions = io.Revisions{}
+		opts.Paths = nil
+		return opts, nil
+	}
+
+	// A single argument naming an existing file that isn't a revision is a patch to display if it holds a diff,
+	// and otherwise a path, as git diff would read it
+	if arg := opts.Revisions.Args; opts.PatchFile == "" && len(arg) == 1 && isRegularFile(arg[0]) && !isRevision(arg[0]) {
+		if looksLikePatch(arg[0]) {
+			opts.PatchFile = arg[0]
+		} else {
+			opts.Paths = append(opts.Paths, arg[0])
+		}
+		opts.Revisions.Args = nil
+	}
+	if opts.PatchFile != "" {
+		if len(opts.Revisions.Args) > 0 || opts.Revisions.Cached || len(opts.Paths) > 0 {
+			return Options{}, fmt.Errorf("a patch cannot be combined with revisions or paths")
+		}
+		return opts, nil
+	}
+
+	// Validate the revision count the same way git diff would
+	revs := opts.Revisions.Args
+	if len(revs) > 2 {
+		return Options{}, fmt.Errorf("too many revisions: %s", strings.Join(revs, " "))
+	}
+	if len(revs) == 2 && (strings.Contains(revs[0], "..") || strings.Contains(revs[1], "..")) {
+		return Options{}, fmt.Errorf("cannot combine a range with another revision: %s", strings.Join(revs, " "))
+	}
+	if opts.Revisions.Cached && len(revs) > 1 {
+		return Options{}, fmt.Errorf("--cached takes at most one revision")
+	}
+	if opts.Revisions.Cached && len(revs) == 1 && strings.Contains(revs[0], "..") {
+		return Options{}, fmt.Errorf("--cached cannot be used with a range")
+	}
+
+	return opts, nil
+}
+
+// isRegularFile returns true if path names an existing regular file
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isRevision returns true if git resolves arg to an object, e.g. a branch that happens to share a file's name
+// Outside a repository nothing is a revision
+func isRevision(arg string) bool {
+	return exec.Command("git", "rev-parse", "--verify", "--quiet", "--end-of-options", arg).Run() == nil
+}
+
+// looksLikePatch returns true if the start of a file has a diff header: a "diff " line,
+// or a "--- " line followed by "+++ " as in plain unified diffs
+func looksLikePatch(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	// Mailboxes can have a long commit message before the first diff
+	scanner := bufio.NewScanner(file)
+	previous := ""
+	for n := 0; n < 10000 && scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "diff ") || (strings.HasPrefix(previous, "--- ") && strings.HasPrefix(line, "+++ ")) {
+			return true
+		}
+		previous = line
+	}
+	return false
+}
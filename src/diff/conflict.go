@@ -0,0 +1,87 @@
+package diff
+
+import (
+	"strings"
+
+	"gg/src/io"
+	"gg/src/models"
+	"gg/src/repo"
+)
+
+// LoadConflicts attaches the three-way merge of every unmerged file to it, for the conflict view
+// Files missing our or their version (deleted on one side) or that can't be merged as text keep
+// only their combined diff
+func LoadConflicts(ctx *repo.Context, files []models.FileDiff) {
+	for i := range files {
+		if files[i].Status != "Unmerged" || files[i].Parent != "" {
+			continue
+		}
+		files[i].Conflict = loadConflict(ctx, files[i].Name)
+	}
+}
+
+// loadConflict merges the index stages of an unmerged path, or returns nil if it can't
+func loadConflict(ctx *repo.Context, path string) *models.Conflict {
+	ours, hasOurs := io.ReadStage(ctx, 2, path)
+	theirs, hasTheirs := io.ReadStage(ctx, 3, path)
+	if !hasOurs || !hasTheirs {
+		return nil
+	}
+	base, hasBase := io.ReadStage(ctx, 1, path)
+
+	merged, err := io.MergeStages(ours, base, theirs)
+	if err != nil {
+		return nil
+	}
+	conflict := ParseMerge(merged)
+	conflict.HasBase = hasBase
+	return conflict
+}
+
+// ParseMerge splits diff3-style merge output into clean regions and conflicts
+// Markers are expected to be io.ConflictMarkerSize characters long
+func ParseMerge(merged string) *models.Conflict {
+	conflict := &models.Conflict{TrailingNewline: strings.HasSuffix(merged, "\n")}
+	if merged == "" {
+		return conflict
+	}
+
+	marker := func(line string, char string) bool {
+		return strings.HasPrefix(line, strings.Repeat(char, io.ConflictMarkerSize)) &&
+			(len(line) == io.ConflictMarkerSize || line[io.ConflictMarkerSize] == ' ')
+	}
+
+	var clean []string
+	var region *models.ConflictRegion
+	section := "" // Side of the conflict being read: "ours", "base" or "theirs"
+	for _, line := range strings.Split(strings.TrimSuffix(merged, "\n"), "\n") {
+		switch {
+		case marker(line, "<"):
+			if len(clean) > 0 {
+				conflict.Regions = append(conflict.Regions, models.ConflictRegion{Lines: clean})
+				clean = nil
+			}
+			region = &models.ConflictRegion{Conflict: true}
+			section = "ours"
+		case region != nil && marker(line, "|"):
+			section = "base"
+		case region != nil && marker(line, "="):
+			section = "theirs"
+		case region != nil && marker(line, ">"):
+			conflict.Regions = append(conflict.Regions, *region)
+			region = nil
+		case region == nil:
+			clean = append(clean, line)
+		case section == "ours":
+			region.Ours = append(region.Ours, line)
+		case section == "base":
+			region.Base = append(region.Base, line)
+		default:
+			region.Theirs = append(region.Theirs, line)
+		}
+	}
+	if len(clean) > 0 {
+		conflict.Regions = append(conflict.Regions, models.ConflictRegion{Lines: clean})
+	}
+	return conflict
+}
@@ -0,0 +1,188 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+
+	"gg/src/models"
+)
+
+// parseHeaderLine records the metadata carried by one extended header line
+func parseHeaderLine(header *models.FileHeader, line string) {
+	switch {
+	case strings.HasPrefix(line, "--- "):
+		if path := parseMarkerPath(line[4:]); path != "" {
+			header.OldPath = path
+		} else {
+			header.IsNew = true
+			header.OldPath = ""
+		}
+	case strings.HasPrefix(line, "+++ "):
+		if path := parseMarkerPath(line[4:]); path != "" {
+			header.NewPath = path
+		} else {
+			header.IsDeleted = true
+			header.NewPath = ""
+		}
+	case strings.HasPrefix(line, "new file mode "):
+		header.IsNew = true
+		header.NewMode = strings.TrimPrefix(line, "new file mode ")
+	case strings.HasPrefix(line, "deleted file mode "):
+		header.IsDeleted = true
+		header.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+	case strings.HasPrefix(line, "old mode "):
+		header.OldMode = strings.TrimPrefix(line, "old mode ")
+	case strings.HasPrefix(line, "new mode "):
+		header.NewMode = strings.TrimPrefix(line, "new mode ")
+	case strings.HasPrefix(line, "similarity index "):
+		header.Similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"))
+	case strings.HasPrefix(line, "rename from "):
+		header.IsRename = true
+		header.OldPath = unquotePath(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		header.IsRename = true
+		header.NewPath = unquotePath(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		header.IsCopy = true
+		header.OldPath = unquotePath(strings.TrimPrefix(line, "copy from "))
+	case strings.HasPrefix(line, "copy to "):
+		header.IsCopy = true
+		header.NewPath = unquotePath(strings.TrimPrefix(line, "copy to "))
+	case strings.HasPrefix(line, "index "):
+		// "index abc..def 100644" carries the mode when it didn't change
+		fields := strings.Fields(line)
+		if len(fields) == 3 && header.OldMode == "" && header.NewMode == "" {
+			header.OldMode, header.NewMode = fields[2], fields[2]
+		}
+	case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+		header.IsBinary = true
+	}
+}
+
+// parseGitDiffPaths extracts the old and new paths from the rest of a "diff --git a/x b/y" line
+// Paths containing spaces are ambiguous here; rename and ---/+++ lines refine them later
+func parseGitDiffPaths(rest string) (string, string) {
+	// Quoted paths: "a/x y" "b/x y"
+	if strings.HasPrefix(rest, "\"") {
+		if end := strings.Index(rest[1:], "\" "); end != -1 {
+			oldPath := unquotePath(rest[:end+2])
+			newPath := unquotePath(rest[end+3:])
+			return stripPrefix(oldPath), stripPrefix(newPath)
+		}
+	}
+
+	// Unchanged names split exactly in half: "a/" + name + " b/" + name
+	if n := len(rest); n >= 5 && (n-5)%2 == 0 {
+		nameLen := (n - 5) / 2
+		if rest[:2] == "a/" && rest[2+nameLen:5+nameLen] == " b/" && rest[2:2+nameLen] == rest[5+nameLen:] {
+			return rest[2 : 2+nameLen], rest[5+nameLen:]
+		}
+	}
+
+	if idx := strings.LastIndex(rest, " b/"); idx != -1 {
+		return stripPrefix(rest[:idx]), rest[idx+3:]
+	}
+	return rest, rest
+}
+
+// parseMarkerPath extracts the path from a "---"/"+++" line, returning "" for /dev/null
+// Plain diffs may append a tab and timestamp after the path
+func parseMarkerPath(value string) string {
+	if tab := strings.Index(value, "\t"); tab != -1 && !strings.HasPrefix(value, "\"") {
+		value = value[:tab]
+	}
+	value = unquotePath(strings.TrimSpace(value))
+	if value == "/dev/null" {
+		return ""
+	}
+	return stripPrefix(value)
+}
+
+// stripPrefix removes git's "a/" or "b/" path prefix
+func stripPrefix(path string) string {
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+// unquotePath decodes a path git quoted because it contains special characters
+func unquotePath(path string) string {
+	if len(path) < 2 || path[0] != '"' || path[len(path)-1] != '"' {
+		return path
+	}
+	if unquoted, err := strconv.Unquote(path); err == nil {
+		return unquoted
+	}
+	return path[1 : len(path)-1]
+}
+
+// quotePath quotes a path the way git does in patch headers when it holds quotes, backslashes or control characters
+func quotePath(path string) string {
+	special := strings.ContainsFunc(path, func(r rune) bool {
+		return r == '"' || r == '\\' || r < ' ' || r == 0x7f
+	})
+	if !special {
+		return path
+	}
+	return strconv.Quote(path)
+}
+
+// parseHunkHeader parses "@@ -a,b +c,d @@ section" (or "@@@ -a,b -c,d +e,f @@@" for combined diffs)
+// Returns the hunk, the number of parents (prefix columns per line), and whether the header was valid
+func parseHunkHeader(line string) (models.Hunk, int, bool) {
+	markerLen := 0
+	for markerLen < len(line) && line[markerLen] == '@' {
+		markerLen++
+	}
+	if markerLen < 2 {
+		return models.Hunk{}, 0, false
+	}
+	marker := line[:markerLen]
+
+	rest := line[markerLen:]
+	end := strings.Index(rest, " "+marker)
+	if end == -1 {
+		return models.Hunk{}, 0, false
+	}
+
+	hunk := models.Hunk{Header: line}
+	hunk.Section = strings.TrimSpace(rest[end+1+markerLen:])
+
+	// The last range is the result; the first is used as the "old" side
+	ranges := strings.Fields(rest[:end])
+	if len(ranges) != markerLen {
+		return models.Hunk{}, 0, false
+	}
+	var ok bool
+	if hunk.OldStart, hunk.OldCount, ok = parseRange(ranges[0], '-'); !ok {
+		return models.Hunk{}, 0, false
+	}
+	if hunk.NewStart, hunk.NewCount, ok = parseRange(ranges[len(ranges)-1], '+'); !ok {
+		return models.Hunk{}, 0, false
+	}
+
+	return hunk, markerLen - 1, true
+}
+
+// parseRange parses "-start,count" or "+start" (count defaults to 1)
+func parseRange(value string, sign byte) (int, int, bool) {
+	if len(value) < 2 || value[0] != sign {
+		return 0, 0, false
+	}
+
+	startText, countText, hasCount := strings.Cut(value[1:], ",")
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	count := 1
+	if hasCount {
+		if count, err = strconv.Atoi(countText); err != nil {
+			return 0, 0, false
+		}
+	}
+
+	return start, count, true
+}
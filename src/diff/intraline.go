@@ -0,0 +1,144 @@
+package diff
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"gg/src/models"
+)
+
+// maxIntraLineCells caps the size of the token comparison table so huge lines stay cheap to render
+const maxIntraLineCells = 40000
+
+// token is a byte range of a line compared as one unit
+type token struct {
+	start int
+	end   int
+}
+
+// ChangedSpans finds which parts of a removed line and its replacement actually differ
+// With byChar false lines are compared word by word (identifiers, whitespace runs and single symbols),
+// otherwise character by character. Returns nil spans when the lines have too little in common
+// for highlighting the differences to help
+func ChangedSpans(oldText, newText string, byChar bool) ([]models.Span, []models.Span) {
+	if oldText == newText {
+		return nil, nil
+	}
+
+	oldTokens := tokenize(oldText, byChar)
+	newTokens := tokenize(newText, byChar)
+	text := func(s string, t token) string { return s[t.start:t.end] }
+
+	// Skip the common prefix and suffix before the quadratic part
+	prefix := 0
+	for prefix < len(oldTokens) && prefix < len(newTokens) &&
+		text(oldText, oldTokens[prefix]) == text(newText, newTokens[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldTokens)-prefix && suffix < len(newTokens)-prefix &&
+		text(oldText, oldTokens[len(oldTokens)-1-suffix]) == text(newText, newTokens[len(newTokens)-1-suffix]) {
+		suffix++
+	}
+
+	oldMiddle := oldTokens[prefix : len(oldTokens)-suffix]
+	newMiddle := newTokens[prefix : len(newTokens)-suffix]
+	if len(oldMiddle)*len(newMiddle) > maxIntraLineCells {
+		return nil, nil
+	}
+
+	// Longest common subsequence of the remaining tokens
+	rows, cols := len(oldMiddle), len(newMiddle)
+	lcs := make([][]int, rows+1)
+	for i := range lcs {
+		lcs[i] = make([]int, cols+1)
+	}
+	for i := rows - 1; i >= 0; i-- {
+		for j := cols - 1; j >= 0; j-- {
+			if text(oldText, oldMiddle[i]) == text(newText, newMiddle[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table, collecting tokens that aren't part of the common subsequence
+	var oldSpans, newSpans []models.Span
+	common := 0
+	for _, t := range oldTokens[:prefix] {
+		common += t.end - t.start
+	}
+	for _, t := range oldTokens[len(oldTokens)-suffix:] {
+		common += t.end - t.start
+	}
+
+	i, j := 0, 0
+	for i < rows || j < cols {
+		switch {
+		case i < rows && j < cols && text(oldText, oldMiddle[i]) == text(newText, newMiddle[j]):
+			common += oldMiddle[i].end - oldMiddle[i].start
+			i++
+			j++
+		case j < cols && (i == rows || lcs[i][j+1] >= lcs[i+1][j]):
+			newSpans = appendSpan(newSpans, newMiddle[j])
+			j++
+		default:
+			oldSpans = appendSpan(oldSpans, oldMiddle[i])
+			i++
+		}
+	}
+
+	// Mostly rewritten lines read better without emphasis
+	if common*4 < max(len(oldText), len(newText)) {
+		return nil, nil
+	}
+
+	return oldSpans, newSpans
+}
+
+// appendSpan adds a token to spans, merging it with the previous span when they touch
+func appendSpan(spans []models.Span, t token) []models.Span {
+	if n := len(spans); n > 0 && spans[n-1].End == t.start {
+		spans[n-1].End = t.end
+		return spans
+	}
+	return append(spans, models.Span{Start: t.start, End: t.end})
+}
+
+// tokenize splits a line into runes, or into words, whitespace runs and single symbols
+func tokenize(s string, byChar bool) []token {
+	var tokens []token
+
+	class := func(r rune) int {
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		default:
+			return 0
+		}
+	}
+
+	for pos := 0; pos < len(s); {
+		r, size := utf8.DecodeRuneInString(s[pos:])
+		end := pos + size
+
+		// Extend words and whitespace runs; symbols and characters stand alone
+		if c := class(r); !byChar && c != 0 {
+			for end < len(s) {
+				next, nextSize := utf8.DecodeRuneInString(s[end:])
+				if class(next) != c {
+					break
+				}
+				end += nextSize
+			}
+		}
+
+		tokens = append(tokens, token{start: pos, end: end})
+		pos = end
+	}
+
+	return tokens
+}
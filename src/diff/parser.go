@@ -5,99 +5,316 @@ import (
 	"os"
 	"strings"
 
+	"gg/src/io"
 	"gg/src/models"
+	"gg/src/repo"
 )
 
-// ParseDiffIntoFiles parses git diff output into separate file diffs
+// ParseDiffIntoFiles parses diff output into separate file diffs with typed headers and hunks
+// Understands git diffs (including renames, binary files and "diff --cc" for unmerged paths)
+// as well as plain unified diffs that only have "---"/"+++" headers
 func ParseDiffIntoFiles(lines []string) []models.FileDiff {
-	var files []models.FileDiff
-	var currentFile *models.FileDiff
-
+	p := &parser{}
 	for _, line := range lines {
-		if strings.HasPrefix(line, "diff --git") {
-			// Extract file name
-			parts := strings.Fields(line)
-			fileName := "unknown"
-			if len(parts) >= 4 {
-				fileName = parts[3]
-				if strings.HasPrefix(fileName, "b/") {
-					fileName = strings.TrimPrefix(fileName, "b/")
-				}
-			}
-
-			// Save previous file if exists
-			if currentFile != nil {
-				files = append(files, *currentFile)
-			}
-
-			// Start new file with default "Modified" status
-			currentFile = &models.FileDiff{
-				Name:    fileName,
-				Content: []string{line},
-				Status:  "Modified",
-			}
-		} else if currentFile != nil {
-			currentFile.Content = append(currentFile.Content, line)
-		}
-	}
-
-	// Don't forget the last file
-	if currentFile != nil {
-		files = append(files, *currentFile)
+		p.feed(line)
 	}
+	p.flushFile()
 
-	// Initialize syntax highlighting, calculate stats, and detect status for all files
+	// Calculate stats and detect status for all files
+	// Syntax highlighting is initialized lazily when a file is first displayed
+	files := p.files
 	for i := range files {
-		files[i].InitSyntaxHighlighting()
+		files[i].Name = files[i].Header.Path()
 		files[i].CalculateStats()
 		detectFileStatus(&files[i])
+		detectSubmodule(&files[i])
 	}
 
 	return files
 }
 
-// detectFileStatus parses the file content to determine its status
-func detectFileStatus(file *models.FileDiff) {
-	for _, line := range file.Content {
-		if strings.HasPrefix(line, "new file mode") {
-			file.Status = "New"
-			return
-		} else if strings.HasPrefix(line, "deleted file mode") {
-			file.Status = "Deleted"
+// SplitFiles splits diff output into chunks of at most n files that can be parsed independently
+// Chunks are cut before "diff " header lines, which can't occur inside a hunk since hunk lines
+// start with a space, "+", "-" or "\". Plain diffs without such headers stay in one chunk
+func SplitFiles(lines []string, n int) [][]string {
+	var chunks [][]string
+	start := 0
+	count := 0
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "diff ") {
+			continue
+		}
+		if count == n {
+			chunks = append(chunks, lines[start:i])
+			start = i
+			count = 0
+		}
+		count++
+	}
+	if start < len(lines) {
+		chunks = append(chunks, lines[start:])
+	}
+	return chunks
+}
+
+// parser is a line-by-line state machine turning diff output into FileDiffs
+type parser struct {
+	files   []models.FileDiff
+	file    *models.FileDiff // File being parsed
+	hunk    *models.Hunk     // Hunk being parsed
+	oldLeft int              // Old file lines still expected in the current hunk
+	newLeft int              // New file lines still expected in the current hunk
+	parents int              // Number of parents for combined diffs, 1 otherwise
+	oldNum  int              // Next old file line number
+	newNum  int              // Next new file line number
+}
+
+// feed consumes a single line of diff output
+func (p *parser) feed(line string) {
+	// Lines inside a hunk are counted, so "--- " or "diff " content is never mistaken for a header
+	if p.hunk != nil {
+		if strings.HasPrefix(line, "\\") {
+			// "\ No newline at end of file" applies to the previous line
+			if n := len(p.hunk.Lines); n > 0 {
+				p.hunk.Lines[n-1].NoNewline = true
+			}
 			return
-		} else if strings.HasPrefix(line, "rename from") {
-			file.Status = "Renamed"
+		}
+		if p.hunkLine(line) {
 			return
 		}
+		p.flushHunk()
+	}
+
+	switch {
+	case strings.HasPrefix(line, "diff --git "):
+		p.startFile(line)
+		p.file.Header.OldPath, p.file.Header.NewPath = parseGitDiffPaths(strings.TrimPrefix(line, "diff --git "))
+
+	case strings.HasPrefix(line, "diff --cc ") || strings.HasPrefix(line, "diff --combined "):
+		p.startFile(line)
+		_, path, _ := strings.Cut(strings.TrimPrefix(line, "diff --"), " ")
+		p.file.Header.OldPath, p.file.Header.NewPath = unquotePath(path), unquotePath(path)
+		p.file.Header.IsCombined = true
+
+	case strings.HasPrefix(line, "--- ") && (p.file == nil || len(p.file.Hunks) > 0):
+		// A plain unified diff has no "diff --git" line; "---" starts the next file
+		p.startFile(line)
+		p.file.Header.OldPath = parseMarkerPath(line[4:])
+		p.file.Header.IsNew = p.file.Header.OldPath == ""
+
+	case p.file == nil:
+		// Preamble before the first file (commit message, diffstat, ...)
+
+	case strings.HasPrefix(line, "@@"):
+		p.startHunk(line)
+
+	case len(p.file.Hunks) == 0 && !p.file.Header.IsBinary:
+		// Extended header lines between "diff --git" and the first hunk
+		p.file.Header.Lines = append(p.file.Header.Lines, line)
+		parseHeaderLine(&p.file.Header, line)
+	}
+}
+
+// hunkLine adds a line to the current hunk, returning false if the line doesn't belong to it
+func (p *parser) hunkLine(line string) bool {
+	if p.oldLeft <= 0 && p.newLeft <= 0 {
+		return false
+	}
+
+	// Some tools strip the trailing space of empty context lines
+	if line == "" {
+		line = strings.Repeat(" ", p.parents)
+	}
+	if len(line) < p.parents {
+		return false
+	}
+
+	prefix := line[:p.parents]
+	if strings.Trim(prefix, " +-") != "" {
+		return false
+	}
+
+	// For combined diffs, a line is added if any parent lacks it and removed if the result lacks it
+	kind := models.LineContext
+	if strings.Contains(prefix, "-") {
+		kind = models.LineRemoved
+	} else if strings.Contains(prefix, "+") {
+		kind = models.LineAdded
+	}
+
+	diffLine := models.DiffLine{Kind: kind, Text: line[p.parents:]}
+	switch kind {
+	case models.LineContext:
+		diffLine.OldNum, diffLine.NewNum = p.oldNum, p.newNum
+		p.oldNum++
+		p.newNum++
+		p.oldLeft--
+		p.newLeft--
+	case models.LineAdded:
+		diffLine.NewNum = p.newNum
+		p.newNum++
+		p.newLeft--
+		// In a combined diff the line may still exist in the first parent
+		if prefix[0] != '+' {
+			diffLine.OldNum = p.oldNum
+			p.oldNum++
+			p.oldLeft--
+		}
+	case models.LineRemoved:
+		diffLine.OldNum = p.oldNum
+		p.oldNum++
+		p.oldLeft--
+	}
+
+	p.hunk.Lines = append(p.hunk.Lines, diffLine)
+	return true
+}
+
+// startFile finishes the current file and begins a new one
+func (p *parser) startFile(line string) {
+	p.flushFile()
+	p.file = &models.FileDiff{
+		Status: "Modified",
+		Header: models.FileHeader{Lines: []string{line}},
+	}
+}
+
+// startHunk begins a new hunk from its "@@" header
+func (p *parser) startHunk(line string) {
+	hunk, parents, ok := parseHunkHeader(line)
+	if !ok {
+		return
+	}
+
+	p.hunk = &hunk
+	p.parents = parents
+	p.oldNum, p.newNum = hunk.OldStart, hunk.NewStart
+	p.oldLeft, p.newLeft = hunk.OldCount, hunk.NewCount
+
+	// Combined diffs only count the result's lines reliably
+	if parents > 1 {
+		p.oldLeft = p.newLeft
+	}
+}
+
+// flushHunk appends the current hunk to the current file
+func (p *parser) flushHunk() {
+	if p.hunk != nil && p.file != nil {
+		p.file.Hunks = append(p.file.Hunks, *p.hunk)
+	}
+	p.hunk = nil
+}
+
+// flushFile appends the current file to the result
+func (p *parser) flushFile() {
+	p.flushHunk()
+	if p.file != nil {
+		p.files = append(p.files, *p.file)
+	}
+	p.file = nil
+}
+
+// detectFileStatus determines the file status from its parsed header
+func detectFileStatus(file *models.FileDiff) {
+	switch {
+	case file.Header.IsCombined:
+		file.Status = "Unmerged"
+	case file.Header.IsNew:
+		file.Status = "New"
+	case file.Header.IsDeleted:
+		file.Status = "Deleted"
+	case file.Header.IsRename:
+		file.Status = "Renamed"
+	case file.Header.IsCopy:
+		file.Status = "Copied"
+	default:
+		// Keep default "Modified" status if no special status detected
+		file.Status = "Modified"
 	}
-	// Keep default "Modified" status if no special status detected
 }
 
 // CreateUntrackedFileDiffs converts a list of untracked file paths to FileDiff objects
 // It reads the file contents and formats them for display
-func CreateUntrackedFileDiffs(untrackedPaths []string) []models.FileDiff {
+// Paths are relative to the repository root, independent of the directory gg was started from
+func CreateUntrackedFileDiffs(ctx *repo.Context, untrackedPaths []string) []models.FileDiff {
 	var files []models.FileDiff
 
 	for _, filePath := range untrackedPaths {
-		content := readFileLines(filePath)
-
-		file := models.FileDiff{
-			Name:      filePath,
-			Content:   content,
-			Status:    "Untracked",
-			Additions: len(content), // Count all lines as additions
-			Deletions: 0,
+		files = append(files, newUntrackedFileDiff(filePath, ctx.Path(filePath)))
+	}
+
+	return files
+}
+
+// CreateNoIndexFileDiffs converts the result of comparing two paths outside git into FileDiff objects
+// Files only on the new side are shown like untracked files
+func CreateNoIndexFileDiffs(entries []io.NoIndexEntry) []models.FileDiff {
+	var files []models.FileDiff
+
+	for _, entry := range entries {
+		if entry.Status == "Untracked" {
+			files = append(files, newUntrackedFileDiff(entry.Name, entry.Path))
+			continue
+		}
+
+		for _, file := range ParseDiffIntoFiles(entry.Lines) {
+			// git names the file by its full path on either side; show the shared relative path
+			file.Name = entry.Name
+			files = append(files, file)
 		}
-		file.InitSyntaxHighlighting()
-		files = append(files, file)
 	}
 
 	return files
 }
 
-// readFileLines reads a file and returns its lines as strings
+// newUntrackedFileDiff creates a FileDiff showing the whole file at path as a single hunk of added lines
+func newUntrackedFileDiff(name, path string) models.FileDiff {
+	content := readFileLines(path)
+
+	file := models.FileDiff{
+		Name:      name,
+		Header:    models.FileHeader{NewPath: name, IsNew: true},
+		Status:    "Untracked",
+		Additions: len(content), // Count all lines as additions
+		Deletions: 0,
+	}
+
+	if len(content) > 0 {
+		hunk := models.Hunk{OldStart: 0, OldCount: 0, NewStart: 1, NewCount: len(content)}
+		for i, line := range content {
+			hunk.Lines = append(hunk.Lines, models.DiffLine{Kind: models.LineAdded, Text: line, NewNum: i + 1})
+		}
+		// Staging part of the file must reproduce a missing final newline
+		hunk.Lines[len(hunk.Lines)-1].NoNewline = !endsWithNewline(path)
+		hunk.Header = hunk.FormatHeader()
+		file.Hunks = []models.Hunk{hunk}
+	}
+
+	return file
+}
+
+// endsWithNewline reports whether the last byte of a file is a newline
+func endsWithNewline(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return true
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return true
+	}
+	return last[0] == '\n'
+}
+
+// readFileLines reads a file and returns its lines as strings, without their "\n"
 func readFileLines(filePath string) []string {
-	// Handle relative paths from git repository root
 	file, err := os.Open(filePath)
 	if err != nil {
 		// If file doesn't exist or can't be read, return empty slice
@@ -111,7 +328,9 @@ func readFileLines(filePath string) []string {
 
 	// Set a larger buffer size for files with long lines
 	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
+	scanner.Buffer(buf, io.MaxLineLength)
+	// CRLF endings stay on the lines, so staging part of the file writes them to the index as they are
+	scanner.Split(io.SplitLines)
 
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
@@ -119,3 +338,33 @@ func readFileLines(filePath string) []string {
 
 	return lines
 }
+
+// MarkStages records on every file whether its changes are staged, unstaged or both
+// A file is considered "both" when it appears in the staged and unstaged sets at once
+func MarkStages(unstaged, staged, all []models.FileDiff) {
+	inUnstaged := make(map[string]bool)
+	for _, f := range unstaged {
+		inUnstaged[f.Name] = true
+	}
+	inStaged := make(map[string]bool)
+	for _, f := range staged {
+		inStaged[f.Name] = true
+	}
+
+	stageOf := func(name string) string {
+		switch {
+		case inUnstaged[name] && inStaged[name]:
+			return "both"
+		case inStaged[name]:
+			return "staged"
+		default:
+			return "unstaged"
+		}
+	}
+
+	for _, set := range [][]models.FileDiff{unstaged, staged, all} {
+		for i := range set {
+			set[i].Stage = stageOf(set[i].Name)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"gg/src/models"
+)
+
+// wantFile is what a test expects of one parsed file
+type wantFile struct {
+	name       string
+	status     string
+	oldPath    string
+	newPath    string
+	oldMode    string
+	newMode    string
+	similarity int
+	binary     bool
+	hunks      int
+	additions  int
+	deletions  int
+}
+
+func TestParseDiffIntoFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		diff  string
+		want  []wantFile
+		check func(t *testing.T, files []models.FileDiff) // Extra checks on the hunk lines
+	}{
+		{
+			name: "rename with changes",
+			diff: `diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+index 1111111..2222222 100644
+--- a/old.go
++++ b/new.go
+@@ -1,2 +1,2 @@
+ package x
+-var a = 1
++var a = 2`,
+			want: []wantFile{{name: "new.go", status: "Renamed", oldPath: "old.go", newPath: "new.go",
+				oldMode: "100644", newMode: "100644", similarity: 90, hunks: 1, additions: 1, deletions: 1}},
+		},
+		{
+			name: "pure rename",
+			diff: `diff --git a/dir/a.txt b/other/a.txt
+similarity index 100%
+rename from dir/a.txt
+rename to other/a.txt`,
+			want: []wantFile{{name: "other/a.txt", status: "Renamed", oldPath: "dir/a.txt", newPath: "other/a.txt", similarity: 100}},
+		},
+		{
+			name: "copy",
+			diff: `diff --git a/a.go b/b.go
+similarity index 75%
+copy from a.go
+copy to b.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/b.go
+@@ -3 +3 @@ func a() {
+-	return 1
++	return 2`,
+			want: []wantFile{{name: "b.go", status: "Copied", oldPath: "a.go", newPath: "b.go",
+				oldMode: "100644", newMode: "100644", similarity: 75, hunks: 1, additions: 1, deletions: 1}},
+			check: func(t *testing.T, files []models.FileDiff) {
+				if section := files[0].Hunks[0].Section; section != "func a() {" {
+					t.Errorf("section = %q", section)
+				}
+			},
+		},
+		{
+			name: "quoted and escaped path",
+			diff: `diff --git "a/t\303\251st\tx.txt" "b/t\303\251st\tx.txt"
+index 1111111..2222222 100644
+--- "a/t\303\251st\tx.txt"
++++ "b/t\303\251st\tx.txt"
+@@ -1 +1 @@
+-a
++b`,
+			want: []wantFile{{name: "tést\tx.txt", status: "Modified", oldPath: "tést\tx.txt", newPath: "tést\tx.txt",
+				oldMode: "100644", newMode: "100644", hunks: 1, additions: 1, deletions: 1}},
+		},
+		{
+			name: "quoted rename",
+			diff: `diff --git "a/say \"hi\".txt" "b/say \"bye\".txt"
+similarity index 100%
+rename from "say \"hi\".txt"
+rename to "say \"bye\".txt"`,
+			want: []wantFile{{name: `say "bye".txt`, status: "Renamed", oldPath: `say "hi".txt`, newPath: `say "bye".txt`, similarity: 100}},
+		},
+		{
+			name: "unquoted path with spaces",
+			diff: `diff --git a/my b/file.txt b/my b/file.txt
+index 1111111..2222222 100644
+--- a/my b/file.txt
++++ b/my b/file.txt
+@@ -1 +1 @@
+-a
++b`,
+			want: []wantFile{{name: "my b/file.txt", status: "Modified", oldPath: "my b/file.txt", newPath: "my b/file.txt",
+				oldMode: "100644", newMode: "100644", hunks: 1, additions: 1, deletions: 1}},
+		},
+		{
+			name: "binary files",
+			diff: `diff --git a/img.png b/img.png
+index 1111111..2222222 100644
+Binary files a/img.png and b/img.png differ
+diff --git a/new.bin b/new.bin
+new file mode 100644
+index 0000000..3333333
+Binary files /dev/null and b/new.bin differ`,
+			want: []wantFile{
+				{name: "img.png", status: "Modified", oldPath: "img.png", newPath: "img.png", oldMode: "100644", newMode: "100644", binary: true},
+				{name: "new.bin", status: "New", oldPath: "new.bin", newPath: "new.bin", newMode: "100644", binary: true},
+			},
+		},
+		{
+			name: "mode only",
+			diff: `diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755`,
+			want: []wantFile{{name: "run.sh", status: "Modified", oldPath: "run.sh", newPath: "run.sh", oldMode: "100644", newMode: "100755"}},
+		},
+		{
+			name: "combined diff of an unmerged file",
+			diff: `diff --cc file.txt
+index 1111111,2222222..0000000
+--- a/file.txt
++++ b/file.txt
+@@@ -1,3 -1,3 +1,7 @@@
+  common
+++<<<<<<< HEAD
+ +ours
+++=======
++ theirs
+++>>>>>>> branch
+  end`,
+			want: []wantFile{{name: "file.txt", status: "Unmerged", oldPath: "file.txt", newPath: "file.txt", hunks: 1, additions: 5}},
+			check: func(t *testing.T, files []models.FileDiff) {
+				if !files[0].Header.IsCombined {
+					t.Error("not marked combined")
+				}
+				lines := files[0].Hunks[0].Lines
+				if len(lines) != 7 {
+					t.Fatalf("got %d lines, want 7", len(lines))
+				}
+				if lines[2].Text != "ours" || lines[2].Kind != models.LineAdded || lines[2].OldNum != 2 || lines[2].NewNum != 3 {
+					t.Errorf("line present in the first parent = %+v", lines[2])
+				}
+				if lines[4].Text != "theirs" || lines[4].OldNum != 0 || lines[4].NewNum != 5 {
+					t.Errorf("line missing from the first parent = %+v", lines[4])
+				}
+				if last := lines[6]; last.Kind != models.LineContext || last.NewNum != 7 {
+					t.Errorf("last line = %+v", last)
+				}
+			},
+		},
+		{
+			name: "no newline at end of file",
+			diff: `diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ x
+-y
+\ No newline at end of file
++z
+\ No newline at end of file`,
+			want: []wantFile{{name: "a.txt", status: "Modified", oldPath: "a.txt", newPath: "a.txt",
+				oldMode: "100644", newMode: "100644", hunks: 1, additions: 1, deletions: 1}},
+			check: func(t *testing.T, files []models.FileDiff) {
+				lines := files[0].Hunks[0].Lines
+				if len(lines) != 3 {
+					t.Fatalf("got %d lines, want 3", len(lines))
+				}
+				if lines[0].NoNewline || !lines[1].NoNewline || !lines[2].NoNewline {
+					t.Errorf("NoNewline = %v %v %v, want false true true", lines[0].NoNewline, lines[1].NoNewline, lines[2].NoNewline)
+				}
+			},
+		},
+		{
+			name: "new and deleted files",
+			diff: `diff --git a/n.txt b/n.txt
+new file mode 100644
+index 0000000..1111111
+--- /dev/null
++++ b/n.txt
+@@ -0,0 +1,2 @@
++a
++b
+diff --git a/d.txt b/d.txt
+deleted file mode 100755
+index 1111111..0000000
+--- a/d.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-a`,
+			want: []wantFile{
+				{name: "n.txt", status: "New", newPath: "n.txt", newMode: "100644", hunks: 1, additions: 2},
+				{name: "d.txt", status: "Deleted", oldPath: "d.txt", oldMode: "100755", hunks: 1, deletions: 1},
+			},
+			check: func(t *testing.T, files []models.FileDiff) {
+				if line := files[0].Hunks[0].Lines[1]; line.NewNum != 2 || line.OldNum != 0 {
+					t.Errorf("added line = %+v", line)
+				}
+			},
+		},
+		{
+			name: "plain unified diff",
+			diff: `--- a/one.txt	2024-01-01 10:00:00.000000000 +0000
++++ b/one.txt	2024-01-02 10:00:00.000000000 +0000
+@@ -1,2 +1 @@
+--- not a header
+ a
+--- /dev/null
++++ two.txt
+@@ -0,0 +1 @@
++new`,
+			want: []wantFile{
+				{name: "one.txt", status: "Modified", oldPath: "one.txt", newPath: "one.txt", hunks: 1, deletions: 1},
+				{name: "two.txt", status: "New", newPath: "two.txt", hunks: 1, additions: 1},
+			},
+			check: func(t *testing.T, files []models.FileDiff) {
+				if line := files[0].Hunks[0].Lines[0]; line.Kind != models.LineRemoved || line.Text != "-- not a header" {
+					t.Errorf("removed line = %+v", line)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := ParseDiffIntoFiles(strings.Split(tt.diff, "\n"))
+			if len(files) != len(tt.want) {
+				t.Fatalf("got %d files, want %d", len(files), len(tt.want))
+			}
+			for i, want := range tt.want {
+				file := files[i]
+				got := wantFile{
+					name:       file.Name,
+					status:     file.Status,
+					oldPath:    file.Header.OldPath,
+					newPath:    file.Header.NewPath,
+					oldMode:    file.Header.OldMode,
+					newMode:    file.Header.NewMode,
+					similarity: file.Header.Similarity,
+					binary:     file.Header.IsBinary,
+					hunks:      len(file.Hunks),
+					additions:  file.Additions,
+					deletions:  file.Deletions,
+				}
+				if got != want {
+					t.Errorf("file %d:\n got %+v\nwant %+v", i, got, want)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, files)
+			}
+		})
+	}
+}
+
+func TestParseHunkHeader(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    models.Hunk
+		parents int
+		ok      bool
+	}{
+		{"@@ -1,3 +1,4 @@ func main() {", models.Hunk{OldStart: 1, OldCount: 3, NewStart: 1, NewCount: 4, Section: "func main() {"}, 1, true},
+		{"@@ -5 +5 @@", models.Hunk{OldStart: 5, OldCount: 1, NewStart: 5, NewCount: 1}, 1, true},
+		{"@@ -0,0 +1,2 @@", models.Hunk{OldStart: 0, OldCount: 0, NewStart: 1, NewCount: 2}, 1, true},
+		{"@@@ -1,3 -1,3 +1,7 @@@", models.Hunk{OldStart: 1, OldCount: 3, NewStart: 1, NewCount: 7}, 2, true},
+		{"@@ -1,3 +1,4", models.Hunk{}, 0, false},
+		{"@@ +1,3 -1,4 @@", models.Hunk{}, 0, false},
+		{"@@@ -1,3 +1,4 @@@", models.Hunk{}, 0, false},
+	}
+
+	for _, tt := range tests {
+		hunk, parents, ok := parseHunkHeader(tt.line)
+		if ok != tt.ok || parents != tt.parents {
+			t.Errorf("%q: parents, ok = %d, %v, want %d, %v", tt.line, parents, ok, tt.parents, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		hunk.Header = ""
+		if hunk.OldStart != tt.want.OldStart || hunk.OldCount != tt.want.OldCount ||
+			hunk.NewStart != tt.want.NewStart || hunk.NewCount != tt.want.NewCount || hunk.Section != tt.want.Section {
+			t.Errorf("%q: got %+v, want %+v", tt.line, hunk, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package diff
+
+import (
+	"regexp"
+	"strings"
+
+	"gg/src/models"
+)
+
+// mboxFromLine matches the first line of every message in a git format-patch mailbox
+var mboxFromLine = regexp.MustCompile(`^From ([0-9a-f]{7,64}) `)
+
+// ParsePatch parses a patch file into file diffs
+// Plain diffs are parsed as-is; git format-patch mailboxes are split into messages
+// and each message's mail header is attached to its files as commit metadata
+func ParsePatch(lines []string) []models.FileDiff {
+	var files []models.FileDiff
+
+	for _, message := range splitMailbox(lines) {
+		// Everything before the first file header is the mail preamble
+		start := diffStart(message)
+		commit := parseCommitInfo(message[:start])
+		messageFiles := ParseDiffIntoFiles(trimSignature(message[start:]))
+		for i := range messageFiles {
+			messageFiles[i].Commit = commit
+		}
+		files = append(files, messageFiles...)
+	}
+
+	return files
+}
+
+// diffStart returns the index of the first file header: a "diff " line, or for plain unified diffs
+// a "--- " line followed by "+++ ". Returns len(lines) when there is none
+func diffStart(lines []string) int {
+	for i, line := range lines {
+		if strings.HasPrefix(line, "diff ") {
+			return i
+		}
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// splitMailbox splits a format-patch mailbox into its messages
+// Input without mbox "From <hash>" lines is returned as a single message
+func splitMailbox(lines []string) [][]string {
+	var messages [][]string
+	start := 0
+
+	for i, line := range lines {
+		if i > start && mboxFromLine.MatchString(line) {
+			messages = append(messages, lines[start:i])
+			start = i
+		}
+	}
+
+	return append(messages, lines[start:])
+}
+
+// parseCommitInfo extracts commit metadata from a mail preamble
+// Returns nil when the preamble doesn't look like a format-patch header
+func parseCommitInfo(preamble []string) *models.CommitInfo {
+	if len(preamble) == 0 {
+		return nil
+	}
+
+	info := &models.CommitInfo{}
+	found := false
+	inHeaders := true
+	lastHeader := ""
+
+	for _, line := range preamble {
+		if inHeaders {
+			if match := mboxFromLine.FindStringSubmatch(line); match != nil {
+				info.Hash = match[1]
+				found = true
+				continue
+			}
+
+			if line == "" {
+				// A blank line ends the mail headers
+				inHeaders = false
+				continue
+			}
+
+			// Folded header lines continue the previous header
+			if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && lastHeader == "Subject" {
+				info.Subject += " " + strings.TrimSpace(line)
+				continue
+			}
+
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			lastHeader = name
+			value = strings.TrimSpace(value)
+			switch name {
+			case "From":
+				info.Author = value
+				found = true
+			case "Date":
+				info.Date = value
+			case "Subject":
+				info.Subject = value
+				found = true
+			}
+			continue
+		}
+
+		// The "---" line separates the message body from the diffstat
+		if line == "---" {
+			break
+		}
+		info.Body = append(info.Body, line)
+	}
+
+	if !found {
+		return nil
+	}
+
+	// Drop the "[PATCH n/m]" prefix git adds to subjects
+	if strings.HasPrefix(info.Subject, "[") {
+		if end := strings.Index(info.Subject, "] "); end != -1 {
+			info.Subject = info.Subject[end+2:]
+		}
+	}
+
+	// Trim blank lines around the body
+	for len(info.Body) > 0 && strings.TrimSpace(info.Body[len(info.Body)-1]) == "" {
+		info.Body = info.Body[:len(info.Body)-1]
+	}
+	for len(info.Body) > 0 && strings.TrimSpace(info.Body[0]) == "" {
+		info.Body = info.Body[1:]
+	}
+
+	return info
+}
+
+// trimSignature removes the "-- " mail signature git appends after the last diff
+// The signature is only dropped when nothing after it looks like diff content,
+// since "-- " is also a valid removed line
+func trimSignature(lines []string) []string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] != "-- " {
+			continue
+		}
+
+		isSignature := true
+		for _, line := range lines[i+1:] {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "+") ||
+				strings.HasPrefix(line, "-") || strings.HasPrefix(line, "@@") ||
+				strings.HasPrefix(line, "\\") || strings.HasPrefix(line, "diff ") {
+				isSignature = false
+				break
+			}
+		}
+		if isSignature {
+			return lines[:i]
+		}
+		break
+	}
+
+	return lines
+}
@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePatchPlainUnifiedDiff(t *testing.T) {
+	lines := strings.Split("--- a.txt\n+++ b.txt\n@@ -1 +1 @@\n-x\n+y", "\n")
+
+	files := ParsePatch(lines)
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+	file := files[0]
+	if file.Header.OldPath != "a.txt" || file.Header.NewPath != "b.txt" {
+		t.Errorf("paths = %q, %q", file.Header.OldPath, file.Header.NewPath)
+	}
+	if file.Commit != nil {
+		t.Errorf("plain diff got commit info %+v", file.Commit)
+	}
+	if file.Additions != 1 || file.Deletions != 1 {
+		t.Errorf("stats = +%d -%d, want +1 -1", file.Additions, file.Deletions)
+	}
+}
+
+func TestParsePatchMailbox(t *testing.T) {
+	mailbox := `From 1111111111111111111111111111111111111111 Mon Sep 17 00:00:00 2001
+From: A U Thor <author@example.com>
+Date: Mon, 1 Jan 2024 10:00:00 +0000
+Subject: [PATCH 1/2] Fix the first thing
+
+Longer explanation
+of the fix.
+---
+ a.txt | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-old
++new
+-- 
+2.39.0
+
+From 2222222222222222222222222222222222222222 Mon Sep 17 00:00:00 2001
+From: Someone Else <else@example.com>
+Date: Tue, 2 Jan 2024 10:00:00 +0000
+Subject: [PATCH 2/2] Add b
+
+---
+diff --git a/b.txt b/b.txt
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/b.txt
+@@ -0,0 +1 @@
++b
+-- 
+2.39.0
+`
+	files := ParsePatch(strings.Split(mailbox, "\n"))
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	first := files[0]
+	if first.Name != "a.txt" || first.Commit == nil {
+		t.Fatalf("first file = %q, commit %+v", first.Name, first.Commit)
+	}
+	if first.Commit.Hash != "1111111111111111111111111111111111111111" || first.Commit.Subject != "Fix the first thing" ||
+		first.Commit.Author != "A U Thor <author@example.com>" {
+		t.Errorf("first commit = %+v", first.Commit)
+	}
+	if got := strings.Join(first.Commit.Body, "\n"); got != "Longer explanation\nof the fix." {
+		t.Errorf("first body = %q", got)
+	}
+	// The signature is dropped, not read as hunk lines
+	if len(first.Hunks) != 1 || len(first.Hunks[0].Lines) != 2 {
+		t.Errorf("first hunks = %+v", first.Hunks)
+	}
+
+	second := files[1]
+	if second.Name != "b.txt" || second.Status != "New" || second.Commit == nil || second.Commit.Subject != "Add b" {
+		t.Errorf("second file = %q %s, commit %+v", second.Name, second.Status, second.Commit)
+	}
+}
@@ -0,0 +1,180 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"gg/src/models"
+)
+
+// LinesPatch builds a patch of only the selected added and removed lines of a file, for git apply --cached
+// Unselected lines are rewritten to match the index: when staging, unselected removals become context
+// and unselected additions are dropped. When unstaging (reverse), the patch of staged changes is applied
+// in reverse, so unselected additions become context and unselected removals are dropped.
+// Hunk headers are recomputed from the lines that remain, each hunk shifted by the ones before it
+func LinesPatch(file *models.FileDiff, lines map[models.LineRef]bool, reverse bool) string {
+	var b strings.Builder
+	writePatchHeader(&b, file, SelectsAll(file, lines))
+
+	offset := 0
+	for hunkIdx, hunk := range file.Hunks {
+		partial, changed := selectLines(hunk, hunkIdx, lines, reverse)
+		if !changed {
+			continue
+		}
+
+		oldCount, newCount := 0, 0
+		for _, line := range partial.Lines {
+			if line.Kind != models.LineAdded {
+				oldCount++
+			}
+			if line.Kind != models.LineRemoved {
+				newCount++
+			}
+		}
+
+		// The side already in the index keeps git's position; the other follows the lines
+		// added or removed by the hunks before it. Empty sides point at the line before the hunk
+		partial.OldCount, partial.NewCount = oldCount, newCount
+		if reverse {
+			before := lineBefore(hunk.NewStart, hunk.NewCount)
+			partial.NewStart = startAfter(before, newCount)
+			partial.OldStart = startAfter(before-offset, oldCount)
+		} else {
+			before := lineBefore(hunk.OldStart, hunk.OldCount)
+			partial.OldStart = startAfter(before, oldCount)
+			partial.NewStart = startAfter(before+offset, newCount)
+		}
+		offset += newCount - oldCount
+
+		partial.Header = partial.FormatHeader()
+		writeHunk(&b, partial)
+	}
+
+	return b.String()
+}
+
+// selectLines rewrites a hunk to hold only the selected changes
+// Returns false if none of the hunk's changes are selected
+func selectLines(hunk models.Hunk, hunkIdx int, lines map[models.LineRef]bool, reverse bool) (models.Hunk, bool) {
+	partial := models.Hunk{Section: hunk.Section}
+	changed := false
+
+	// Lines the index holds stay as context, lines it doesn't are dropped
+	kept := models.LineRemoved
+	if reverse {
+		kept = models.LineAdded
+	}
+
+	for i, line := range hunk.Lines {
+		switch {
+		case line.Kind == models.LineContext:
+			partial.Lines = append(partial.Lines, line)
+		case lines[models.LineRef{Hunk: hunkIdx, Line: i}]:
+			partial.Lines = append(partial.Lines, line)
+			changed = true
+		case line.Kind == kept:
+			line.Kind = models.LineContext
+			partial.Lines = append(partial.Lines, line)
+		}
+	}
+	partial.Lines = endWithoutNewline(partial.Lines, kept)
+	return partial, changed
+}
+
+// endWithoutNewline keeps each line marked "\ No newline at end of file" last on its side of the hunk
+// Such a line followed by selected lines gains a newline on the side the patch writes. The side the index
+// holds must stay as it is, so a context line is split into its removal and its re-addition with a newline
+func endWithoutNewline(lines []models.DiffLine, kept models.LineKind) []models.DiffLine {
+	written := models.LineAdded
+	if kept == models.LineAdded {
+		written = models.LineRemoved
+	}
+	last := -1
+	for i, line := range lines {
+		if line.Kind != kept {
+			last = i
+		}
+	}
+
+	var fixed []models.DiffLine
+	for i, line := range lines {
+		if !line.NoNewline || line.Kind == kept || i == last {
+			fixed = append(fixed, line)
+			continue
+		}
+		if line.Kind == models.LineContext {
+			removal := line
+			removal.Kind = kept
+			fixed = append(fixed, removal)
+		}
+		line.Kind = written
+		line.NoNewline = false
+		fixed = append(fixed, line)
+	}
+	return fixed
+}
+
+// SelectsAll reports whether every added and removed line of the file is selected
+func SelectsAll(file *models.FileDiff, lines map[models.LineRef]bool) bool {
+	for hunkIdx, hunk := range file.Hunks {
+		for i, line := range hunk.Lines {
+			if line.Kind != models.LineContext && !lines[models.LineRef{Hunk: hunkIdx, Line: i}] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lineBefore returns the line preceding a hunk given its "@@" start and count
+// git writes the start of an empty range as the line before it
+func lineBefore(start, count int) int {
+	if count == 0 {
+		return start
+	}
+	return start - 1
+}
+
+// startAfter returns the "@@" start of a range of count lines following line before
+func startAfter(before, count int) int {
+	if count == 0 {
+		return before
+	}
+	return before + 1
+}
+
+// writePatchHeader writes the file header of a patch changing a file's content
+// Renames and mode changes are left out: only the lines of the file in the index are patched.
+// A patch taking all of an added or deleted file keeps its header, so the index entry is created or removed with it
+func writePatchHeader(b *strings.Builder, file *models.FileDiff, whole bool) {
+	if whole && (file.Header.IsNew || file.Header.IsDeleted) && len(file.Header.Lines) > 0 {
+		for _, line := range file.Header.Lines {
+			b.WriteString(line + "\n")
+		}
+		return
+	}
+
+	path := file.Header.Path()
+	fmt.Fprintf(b, "diff --git %s %s\n", quotePath("a/"+path), quotePath("b/"+path))
+	fmt.Fprintf(b, "--- %s\n+++ %s\n", quotePath("a/"+path), quotePath("b/"+path))
+}
+
+// writeHunk writes a hunk's header and lines in unified diff format
+func writeHunk(b *strings.Builder, hunk models.Hunk) {
+	b.WriteString(hunk.Header + "\n")
+	for _, line := range hunk.Lines {
+		switch line.Kind {
+		case models.LineAdded:
+			b.WriteString("+")
+		case models.LineRemoved:
+			b.WriteString("-")
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(line.Text + "\n")
+		if line.NoNewline {
+			b.WriteString("\\ No newline at end of file\n")
+		}
+	}
+}
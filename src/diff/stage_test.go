@@ -0,0 +1,363 @@
+package diff
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gg/src/io"
+	"gg/src/models"
+	"gg/src/repo"
+)
+
+// testRepo is a throwaway git repository for checking patches against a real index
+type testRepo struct {
+	t   *testing.T
+	dir string
+	ctx *repo.Context
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	r := &testRepo{t: t, dir: t.TempDir()}
+	r.git("init", "--quiet")
+	ctx, err := repo.DiscoverAt(r.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ctx = ctx
+	return r
+}
+
+// git runs a git command in the repository, failing the test if it fails
+func (r *testRepo) git(args ...string) string {
+	r.t.Helper()
+	output, err := r.gitInput("", args...)
+	if err != nil {
+		r.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return output
+}
+
+// gitInput runs a git command with stdin, returning its combined output
+func (r *testRepo) gitInput(stdin string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=gg", "-c", "user.email=gg@localhost",
+		"-c", "core.autocrlf=false"}, args...)...)
+	cmd.Dir = r.dir
+	cmd.Stdin = strings.NewReader(stdin)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// write writes a file in the working tree
+func (r *testRepo) write(name, content string) {
+	r.t.Helper()
+	if err := os.WriteFile(filepath.Join(r.dir, name), []byte(content), 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// commit writes a file and commits it
+func (r *testRepo) commit(name, content string) {
+	r.t.Helper()
+	r.write(name, content)
+	r.git("add", "--", name)
+	r.git("commit", "--quiet", "-m", "base")
+}
+
+// diff reads and parses a diff set, "unstaged" or "staged", the way gg loads it
+func (r *testRepo) diff(set string) []models.FileDiff {
+	r.t.Helper()
+	lines, err := io.ReadDiffSet(r.ctx, io.Revisions{}, nil, set)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	files := ParseDiffIntoFiles(lines)
+	if len(files) != 1 {
+		r.t.Fatalf("%s diff: got %d files, want 1", set, len(files))
+	}
+	return files
+}
+
+// apply checks the patch with git apply --cached --check, then applies it
+func (r *testRepo) apply(patch string, reverse bool) {
+	r.t.Helper()
+	args := []string{"apply", "--cached"}
+	if reverse {
+		args = append(args, "--reverse")
+	}
+	if output, err := r.gitInput(patch, append(args, "--check", "-")...); err != nil {
+		r.t.Fatalf("git apply --check rejected the patch: %v\n%s\npatch:\n%s", err, output, patch)
+	}
+	if output, err := r.gitInput(patch, append(args, "-")...); err != nil {
+		r.t.Fatalf("git apply failed: %v\n%s", err, output)
+	}
+}
+
+// applyIndex applies the patch and returns the resulting index content of name
+func (r *testRepo) applyIndex(patch string, reverse bool, name string) string {
+	r.t.Helper()
+	r.apply(patch, reverse)
+	return r.index(name)
+}
+
+// index returns the content of a file in the index
+func (r *testRepo) index(name string) string {
+	r.t.Helper()
+	return r.git("show", ":"+name)
+}
+
+// pick selects the changed lines of a file whose text is one of texts
+func pick(file *models.FileDiff, texts ...string) map[models.LineRef]bool {
+	lines := make(map[models.LineRef]bool)
+	for h, hunk := range file.Hunks {
+		for i, line := range hunk.Lines {
+			if line.Kind != models.LineContext && slices.Contains(texts, line.Text) {
+				lines[models.LineRef{Hunk: h, Line: i}] = true
+			}
+		}
+	}
+	return lines
+}
+
+// numbered returns n distinct lines, so git diff can tell them apart
+func numbered(n int) []string {
+	var lines []string
+	for i := 1; i <= n; i++ {
+		lines = append(lines, strings.Repeat("x", i%3)+string(rune('a'+i%26))+strings.Repeat("y", i))
+	}
+	return lines
+}
+
+// joinLines joins lines into file content ending with a newline
+func joinLines(lines ...string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// patchChange commits index as f.txt, changes it to target and applies the picked lines of the diff:
+// staged from the working tree, or with reverse unstaged after staging the whole change
+// Returns the index content of f.txt that results
+func patchChange(t *testing.T, index, target string, picked []string, reverse bool) string {
+	t.Helper()
+	r := newTestRepo(t)
+	r.commit("f.txt", index)
+	r.write("f.txt", target)
+
+	var file *models.FileDiff
+	if reverse {
+		r.git("add", "f.txt")
+		file = &r.diff("staged")[0]
+	} else {
+		file = &r.diff("unstaged")[0]
+	}
+	return r.applyIndex(LinesPatch(file, pick(file, picked...), reverse), reverse, "f.txt")
+}
+
+func TestLinesPatchAcrossHunks(t *testing.T) {
+	r := newTestRepo(t)
+	base := numbered(30)
+	r.commit("f.txt", joinLines(base...))
+
+	// Two lines inserted near the top and one line changed near the bottom, in separate hunks
+	worktree := slices.Clone(base)
+	worktree = slices.Insert(worktree, 2, "new one", "new two")
+	worktree[27] = "changed"
+	r.write("f.txt", joinLines(worktree...))
+
+	file := &r.diff("unstaged")[0]
+	if len(file.Hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(file.Hunks))
+	}
+	// Only one insertion is staged, so the second hunk moves down one line rather than two
+	got := r.applyIndex(LinesPatch(file, pick(file, "new two", base[25], "changed"), false), false, "f.txt")
+
+	want := slices.Clone(base)
+	want = slices.Insert(want, 2, "new two")
+	want[26] = "changed"
+	if got != joinLines(want...) {
+		t.Errorf("index =\n%s\nwant\n%s", got, joinLines(want...))
+	}
+}
+
+func TestLinesPatchUnstage(t *testing.T) {
+	r := newTestRepo(t)
+	base := numbered(30)
+	r.commit("f.txt", joinLines(base...))
+
+	staged := slices.Clone(base)
+	staged = slices.Insert(staged, 2, "new one", "new two")
+	staged[27] = "changed"
+	staged = slices.Delete(staged, 20, 22)
+	r.write("f.txt", joinLines(staged...))
+	r.git("add", "f.txt")
+
+	// Taking back one insertion, the change and one of the two deletions
+	file := &r.diff("staged")[0]
+	got := r.applyIndex(LinesPatch(file, pick(file, "new one", base[25], "changed", base[18]), true), true, "f.txt")
+
+	want := slices.Clone(base)
+	want = slices.Delete(want, 19, 20)
+	want = slices.Insert(want, 2, "new two")
+	if got != joinLines(want...) {
+		t.Errorf("index =\n%s\nwant\n%s", got, joinLines(want...))
+	}
+}
+
+func TestLinesPatchEmptySides(t *testing.T) {
+	// Hunks of an empty file have no old lines, and those emptying a file no new ones
+	tests := []struct {
+		name    string
+		index   string // Content the diff starts from
+		target  string // Content the diff ends at
+		pick    []string
+		reverse bool
+		want    string
+	}{
+		{name: "stage part of lines added to an empty file", index: "", target: "a\nb\nc\n", pick: []string{"a", "c"}, want: "a\nc\n"},
+		{name: "stage all of emptying a file", index: "a\nb\n", target: "", pick: []string{"a", "b"}, want: ""},
+		{name: "stage part of emptying a file", index: "a\nb\nc\n", target: "", pick: []string{"b"}, want: "a\nc\n"},
+		{name: "unstage part of lines added to an empty file", index: "", target: "a\nb\nc\n", pick: []string{"b"}, reverse: true, want: "a\nc\n"},
+		{name: "unstage part of emptying a file", index: "a\nb\nc\n", target: "", pick: []string{"a", "c"}, reverse: true, want: "a\nc\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := patchChange(t, tt.index, tt.target, tt.pick, tt.reverse); got != tt.want {
+				t.Errorf("index = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesPatchDeletedFile(t *testing.T) {
+	r := newTestRepo(t)
+	r.commit("f.txt", joinLines("a", "b", "c"))
+	if err := os.Remove(filepath.Join(r.dir, "f.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Part of a deletion keeps the file, the rest removes it from the index
+	file := &r.diff("unstaged")[0]
+	if got := r.applyIndex(LinesPatch(file, pick(file, "b"), false), false, "f.txt"); got != joinLines("a", "c") {
+		t.Errorf("index = %q, want %q", got, joinLines("a", "c"))
+	}
+	file = &r.diff("unstaged")[0]
+	r.apply(LinesPatch(file, pick(file, "a", "c"), false), false)
+	if output, err := r.gitInput("", "ls-files", "--error-unmatch", "f.txt"); err == nil {
+		t.Errorf("f.txt is still in the index: %s", output)
+	}
+}
+
+func TestLinesPatchNoNewline(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   string // Content the diff starts from
+		target  string // Content the diff ends at
+		pick    []string
+		reverse bool
+		want    string
+	}{
+		{
+			// The unselected removal of the last line stays in the index without its newline,
+			// so the addition after it has to give it one
+			name:   "unselected removal before selected addition",
+			index:  "a\nb",
+			target: "a\nb\nc\n",
+			pick:   []string{"c"},
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "selected removal",
+			index:  "a\nb",
+			target: "a\nc\n",
+			pick:   []string{"b"},
+			want:   "a\n",
+		},
+		{
+			name:   "unselected addition without newline",
+			index:  "a\nb\n",
+			target: "a\nc\nd",
+			pick:   []string{"b", "c"},
+			want:   "a\nc\n",
+		},
+		{
+			name:    "unstage addition after line that gained a newline",
+			index:   "a\nb",
+			target:  "a\nb\nc\n",
+			pick:    []string{"c"},
+			reverse: true,
+			want:    "a\nb\n",
+		},
+		{
+			// Putting back the old last line leaves the lines after it, so it comes back with a newline
+			name:    "unstage removal of line without newline",
+			index:   "a\nb",
+			target:  "a\nB\nc\n",
+			pick:    []string{"b"},
+			reverse: true,
+			want:    "a\nb\nB\nc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := patchChange(t, tt.index, tt.target, tt.pick, tt.reverse); got != tt.want {
+				t.Errorf("index = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesPatchCRLF(t *testing.T) {
+	// The "\r" of each line is part of its text, so the patch matches the index byte for byte
+	tests := []struct {
+		name    string
+		pick    []string
+		reverse bool
+		want    string
+	}{
+		{name: "stage", pick: []string{"b\r", "B\r"}, want: "a\r\nB\r\nc\r\n"},
+		{name: "stage an addition only", pick: []string{"d\r"}, want: "a\r\nb\r\nc\r\nd\r\n"},
+		{name: "unstage", pick: []string{"d\r"}, reverse: true, want: "a\r\nB\r\nc\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := patchChange(t, "a\r\nb\r\nc\r\n", "a\r\nB\r\nc\r\nd\r\n", tt.pick, tt.reverse); got != tt.want {
+				t.Errorf("index = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesPatchIntentToAdd(t *testing.T) {
+	r := newTestRepo(t)
+	r.commit("other.txt", "x\n")
+	r.write("new.txt", "one\ntwo\nthree")
+
+	file := &CreateUntrackedFileDiffs(r.ctx, []string{"new.txt"})[0]
+
+	// Part of an untracked file is patched onto an empty intent-to-add entry
+	r.git("add", "--intent-to-add", "new.txt")
+	if got := r.applyIndex(LinesPatch(file, pick(file, "one", "three"), false), false, "new.txt"); got != "one\nthree" {
+		t.Errorf("index = %q, want %q", got, "one\nthree")
+	}
+}
+
+func TestLinesPatchIntentToAddCRLF(t *testing.T) {
+	r := newTestRepo(t)
+	r.commit("other.txt", "x\n")
+	r.write("new.txt", "one\r\ntwo\r\nthree\r\n")
+
+	file := &CreateUntrackedFileDiffs(r.ctx, []string{"new.txt"})[0]
+	r.git("add", "--intent-to-add", "new.txt")
+	if got := r.applyIndex(LinesPatch(file, pick(file, "one\r", "three\r"), false), false, "new.txt"); got != "one\r\nthree\r\n" {
+		t.Errorf("index = %q, want %q", got, "one\r\nthree\r\n")
+	}
+}
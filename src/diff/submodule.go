@@ -0,0 +1,131 @@
+package diff
+
+import (
+	"strings"
+
+	"gg/src/io"
+	"gg/src/models"
+	"gg/src/repo"
+)
+
+// subprojectPrefix starts the pseudo-content git prints for a submodule's recorded commit
+const subprojectPrefix = "Subproject commit "
+
+// detectSubmodule recognises a submodule entry by its "Subproject commit" lines
+// and records the old and new commits instead of counting them as changed lines
+func detectSubmodule(file *models.FileDiff) {
+	var info *models.SubmoduleInfo
+
+	for _, hunk := range file.Hunks {
+		for _, line := range hunk.Lines {
+			if !strings.HasPrefix(line.Text, subprojectPrefix) {
+				continue
+			}
+			if info == nil {
+				info = &models.SubmoduleInfo{}
+			}
+
+			commit := strings.TrimPrefix(line.Text, subprojectPrefix)
+			if strings.HasSuffix(commit, "-dirty") {
+				commit = strings.TrimSuffix(commit, "-dirty")
+				info.Dirty = true
+			}
+
+			switch line.Kind {
+			case models.LineRemoved:
+				info.OldCommit = commit
+			case models.LineAdded:
+				info.NewCommit = commit
+			case models.LineContext:
+				// Unchanged commit with a dirty working tree
+				info.OldCommit = commit
+				info.NewCommit = commit
+			}
+		}
+	}
+
+	if info != nil {
+		file.Submodule = info
+		file.Additions = 0
+		file.Deletions = 0
+	}
+}
+
+// ExpandSubmodules reads the commit log for every submodule change in files
+// When recurse is true, each submodule's own file diffs are inserted as tabs right after it,
+// named by their path in the superproject and rolled up into the submodule's stats
+// worktree tells whether the new side of the comparison is the working tree
+func ExpandSubmodules(ctx *repo.Context, files []models.FileDiff, worktree bool, recurse bool) []models.FileDiff {
+	var result []models.FileDiff
+
+	for _, file := range files {
+		if file.Submodule == nil || ctx == nil {
+			result = append(result, file)
+			continue
+		}
+
+		// Copy so the same parsed file can be expanded differently per diff set
+		info := *file.Submodule
+		file.Submodule = &info
+
+		sub, err := ctx.Submodule(file.Name)
+		if err != nil {
+			info.Error = err.Error()
+			result = append(result, file)
+			continue
+		}
+
+		info.Log, err = io.ReadSubmoduleLog(sub, info.OldCommit, info.NewCommit)
+		if err != nil {
+			info.Error = "commits are not available in the submodule"
+		}
+
+		if !recurse {
+			result = append(result, file)
+			continue
+		}
+
+		nested := readSubmoduleFiles(sub, &info, worktree)
+		nested = ExpandSubmodules(sub, nested, worktree, recurse)
+
+		// Prefix nested paths with the submodule path and roll their stats up
+		file.Additions = 0
+		file.Deletions = 0
+		for i := range nested {
+			if nested[i].Parent == "" {
+				nested[i].Parent = file.Name
+				file.Additions += nested[i].Additions
+				file.Deletions += nested[i].Deletions
+			} else {
+				nested[i].Parent = file.Name + "/" + nested[i].Parent
+			}
+			nested[i].Name = file.Name + "/" + nested[i].Name
+		}
+		info.Expanded = true
+
+		result = append(result, file)
+		result = append(result, nested...)
+	}
+
+	return result
+}
+
+// readSubmoduleFiles diffs the inside of a submodule, including its untracked files
+// when the working tree is part of the comparison
+func readSubmoduleFiles(sub *repo.Context, info *models.SubmoduleInfo, worktree bool) []models.FileDiff {
+	lines, err := io.ReadSubmoduleDiff(sub, info.OldCommit, info.NewCommit, worktree)
+	if err != nil {
+		info.Error = "failed to diff submodule: " + err.Error()
+		return nil
+	}
+	files := ParseDiffIntoFiles(lines)
+
+	if worktree {
+		untracked, err := io.ReadUntrackedFiles(sub, nil)
+		if err == nil {
+			files = append(files, CreateUntrackedFileDiffs(sub, untracked)...)
+		}
+	}
+
+	return files
+}
@@ -0,0 +1,109 @@
+package io
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gg/src/repo"
+)
+
+// CommitOptions are the git commit flags picked in the commit composer
+type CommitOptions struct {
+	Amend    bool // Replace the last commit (--amend)
+	SignOff  bool // Add a Signed-off-by trailer (--signoff)
+	NoVerify bool // Skip the pre-commit and commit-msg hooks (--no-verify)
+}
+
+// Commit runs git commit with the message on stdin, returning what git and the hooks printed
+// The output is returned on failure too, as it says why, e.g. which hook rejected the commit
+func Commit(ctx *repo.Context, message string, opts CommitOptions) (string, error) {
+	args := []string{"commit", "--file=-"}
+	if opts.Amend {
+		args = append(args, "--amend")
+	}
+	if opts.SignOff {
+		args = append(args, "--signoff")
+	}
+	if opts.NoVerify {
+		args = append(args, "--no-verify")
+	}
+
+	cmd := ctx.Command(args...)
+	cmd.Stdin = strings.NewReader(message)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("git commit failed: %w", err)
+	}
+	return string(output), nil
+}
+
+// LastCommitMessage returns the message of the commit HEAD points to, for amending it
+func LastCommitMessage(ctx *repo.Context) (string, error) {
+	output, err := ctx.Command("log", "-1", "--format=%B", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("no commit to amend")
+	}
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+// StagedFile is a file staged for the next commit, as git diff --cached counts it
+type StagedFile struct {
+	Path      string
+	Status    string // "New", "Deleted", "Renamed", "Copied", "Modified" or "Unmerged"
+	Additions int
+	Deletions int // Both zero for binary files
+}
+
+// stagedStatuses names the status letters of git diff --raw
+var stagedStatuses = map[byte]string{'A': "New", 'D': "Deleted", 'R': "Renamed", 'C': "Copied", 'U': "Unmerged"}
+
+// ReadStaged lists everything staged for the next commit, over the whole repository whatever the pathspecs
+func ReadStaged(ctx *repo.Context) ([]StagedFile, error) {
+	output, err := ctx.Command("diff", "--cached", "--raw", "--numstat", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staged changes: %w", err)
+	}
+
+	// The raw entries, ":<modes and hashes> <status>" then the path (old and new for renames and copies),
+	// are followed by the numstat entries in the same order, "<added>\t<deleted>\t<path>" or with
+	// an empty path followed by the old and new paths
+	var files []StagedFile
+	fields := strings.Split(string(output), "\x00")
+	counted := 0
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if strings.HasPrefix(field, ":") {
+			status := field[strings.LastIndexByte(field, ' ')+1:]
+			if status == "" {
+				continue
+			}
+			file := StagedFile{Status: "Modified"}
+			if name, ok := stagedStatuses[status[0]]; ok {
+				file.Status = name
+			}
+			if status[0] == 'R' || status[0] == 'C' {
+				i++
+			}
+			if i+1 < len(fields) {
+				i++
+				file.Path = fields[i]
+			}
+			files = append(files, file)
+			continue
+		}
+
+		counts := strings.SplitN(field, "\t", 3)
+		if len(counts) < 3 || counted >= len(files) {
+			continue
+		}
+		// Binary files count as "-"
+		files[counted].Additions, _ = strconv.Atoi(counts[0])
+		files[counted].Deletions, _ = strconv.Atoi(counts[1])
+		counted++
+		if counts[2] == "" {
+			i += 2
+		}
+	}
+	return files, nil
+}
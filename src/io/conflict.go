@@ -0,0 +1,72 @@
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"gg/src/repo"
+)
+
+// ConflictMarkerSize is the length of the conflict markers MergeStages asks git for
+// Longer than git's default of 7, so marker-like lines in the files themselves aren't mistaken for markers
+const ConflictMarkerSize = 32
+
+// ReadStage reads the version of an unmerged path held in an index stage:
+// 1 for the common ancestor (base), 2 for ours and 3 for theirs
+// ok is false when the stage is missing, e.g. no base for a file added on both sides
+func ReadStage(ctx *repo.Context, stage int, path string) (content []byte, ok bool) {
+	output, err := ctx.Command("show", ":"+strconv.Itoa(stage)+":"+path).Output()
+	if err != nil {
+		return nil, false
+	}
+	return output, true
+}
+
+// MergeStages merges ours and theirs against base with git merge-file in diff3 style,
+// returning the merged content with conflicts marked by ConflictMarkerSize-long markers
+func MergeStages(ours, base, theirs []byte) (string, error) {
+	dir, err := os.MkdirTemp("", "gg-merge-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{"ours", "base", "theirs"}
+	for i, content := range [][]byte{ours, base, theirs} {
+		if err := os.WriteFile(filepath.Join(dir, names[i]), content, 0o600); err != nil {
+			return "", err
+		}
+	}
+
+	cmd := exec.Command("git", "merge-file", "-p", "--diff3", "--marker-size="+strconv.Itoa(ConflictMarkerSize),
+		"-L", "ours", "-L", "base", "-L", "theirs", "ours", "base", "theirs")
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// merge-file exits with the number of conflicts; only negative statuses are failures
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() > 127 {
+			return "", fmt.Errorf("git merge-file failed: %w", err)
+		}
+	}
+	return stdout.String(), nil
+}
+
+// ResolvePath writes the resolved content of an unmerged path to the working tree
+// and marks the conflict resolved by staging it with git add
+func ResolvePath(ctx *repo.Context, path string, content []byte) error {
+	file := ctx.Path(path)
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(file, content, mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return StagePaths(ctx, path)
+}
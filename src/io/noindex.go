@@ -0,0 +1,164 @@
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NoIndexEntry is one changed path found when comparing two files or directories outside git
+type NoIndexEntry struct {
+	Name   string   // Path relative to both roots (or the new file's path when comparing two files)
+	Status string   // "Modified", "Deleted", or "Untracked" for files only on the new side
+	Path   string   // Full path of the file on the new side, used to read untracked contents
+	Lines  []string // Raw git diff output for modified and deleted files
+}
+
+// ReadNoIndex compares two files or two directory trees with git diff --no-index
+// Works outside of any git repository
+func ReadNoIndex(oldPath, newPath string) ([]NoIndexEntry, error) {
+	oldInfo, err := os.Stat(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newInfo, err := os.Stat(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldInfo.IsDir() != newInfo.IsDir() {
+		return nil, fmt.Errorf("cannot compare a file with a directory: %s %s", oldPath, newPath)
+	}
+
+	// Two plain files produce a single entry
+	if !oldInfo.IsDir() {
+		lines, err := runNoIndexDiff(oldPath, newPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) == 0 {
+			return nil, nil
+		}
+		return []NoIndexEntry{{Name: newPath, Status: "Modified", Path: newPath, Lines: lines}}, nil
+	}
+
+	oldFiles, err := listFiles(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := listFiles(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the union of relative paths in a stable order
+	names := make([]string, 0, len(oldFiles)+len(newFiles))
+	for name := range oldFiles {
+		names = append(names, name)
+	}
+	for name := range newFiles {
+		if !oldFiles[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var entries []NoIndexEntry
+	for _, name := range names {
+		oldFile := filepath.Join(oldPath, name)
+		newFile := filepath.Join(newPath, name)
+
+		switch {
+		case !newFiles[name]:
+			// Only on the old side: show as deleted
+			lines, err := runNoIndexDiff(oldFile, os.DevNull)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, NoIndexEntry{Name: name, Status: "Deleted", Path: newFile, Lines: lines})
+
+		case !oldFiles[name]:
+			// Only on the new side: show like an untracked file
+			entries = append(entries, NoIndexEntry{Name: name, Status: "Untracked", Path: newFile})
+
+		default:
+			// Skip the git call entirely for identical files
+			if sameContents(oldFile, newFile) {
+				continue
+			}
+			lines, err := runNoIndexDiff(oldFile, newFile)
+			if err != nil {
+				return nil, err
+			}
+			if len(lines) > 0 {
+				entries = append(entries, NoIndexEntry{Name: name, Status: "Modified", Path: newFile, Lines: lines})
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// listFiles returns the set of regular files below root, as slash-separated relative paths
+func listFiles(root string) (map[string]bool, error) {
+	files := make(map[string]bool)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Repository metadata isn't part of the compared content
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+
+	return files, err
+}
+
+// sameContents returns true if both files can be read and are byte-for-byte identical
+func sameContents(a, b string) bool {
+	aData, err := os.ReadFile(a)
+	if err != nil {
+		return false
+	}
+	bData, err := os.ReadFile(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aData, bData)
+}
+
+// runNoIndexDiff runs git diff --no-index on two paths
+// git exits with status 1 when the files differ, which isn't an error here
+func runNoIndexDiff(oldPath, newPath string) ([]string, error) {
+	output, err := exec.Command("git", "diff", "--no-index", "--", oldPath, newPath).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return nil, fmt.Errorf("git command failed: %w", err)
+		}
+	}
+
+	text := strings.TrimRight(string(output), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
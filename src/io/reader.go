@@ -2,34 +2,121 @@ package io
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
+	"sync"
+
+	"gg/src/repo"
 )
 
-// ReadDiff reads diff content by running git diff command
-// Falls back to staged changes if working tree is empty
-func ReadDiff() ([]string, string, error) {
-	// Try working tree changes first
-	lines, err := runGitDiff("git", "diff")
-	if err != nil {
-		return nil, "", err
+// emptyTreeHash is the well-known hash of git's empty tree, used as the
+// base for "all" diffs in repositories without any commits yet
+const emptyTreeHash = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// DiffSet holds the raw diff output for every diff type gg can display
+// When explicit revisions are given only All is populated, holding the requested range
+type DiffSet struct {
+	Unstaged []string // git diff: index vs working tree
+	Staged   []string // git diff --cached: HEAD vs index
+	All      []string // git diff HEAD: HEAD vs working tree
+}
+
+// DiffSetNames lists the sets ReadDiff fills for the given revisions
+// The default comparison has all three; explicit revisions only fill "all" with the requested range
+func DiffSetNames(revs Revisions) []string {
+	if !revs.IsDefault() {
+		return []string{"all"}
 	}
+	return []string{"unstaged", "staged", "all"}
+}
 
-	// If working tree is empty, fall back to staged changes
-	if len(lines) == 0 {
-		lines, err = runGitDiff("git", "diff", "--cached")
-		if err != nil {
-			return nil, "", err
+// ReadDiffSet reads the raw diff of one set: "unstaged", "staged" or "all"
+// Non-empty pathspecs (relative to the repository root) limit the diff to the matching paths
+func ReadDiffSet(ctx *repo.Context, revs Revisions, pathspecs []string, name string) ([]string, error) {
+	var args []string
+	switch {
+	case !revs.IsDefault():
+		args = revs.DiffArgs()
+	case name == "unstaged":
+		// Working tree changes not yet staged
+		args = []string{"diff"}
+	case name == "staged":
+		// Changes staged in the index
+		args = []string{"diff", "--cached"}
+	default:
+		// Everything between HEAD and the working tree
+		// Fall back to the empty tree when HEAD doesn't exist yet (fresh repository)
+		base := "HEAD"
+		if err := ctx.Command("rev-parse", "--verify", "--quiet", "HEAD").Run(); err != nil {
+			base = emptyTreeHash
+		}
+		args = []string{"diff", base}
+	}
+	return runGitDiff(ctx.Command(WithPathspecs(args, pathspecs)...))
+}
+
+// ReadDiff reads unstaged, staged and combined diff content by running the git diffs concurrently
+// With explicit revisions it reads just the requested comparison instead
+func ReadDiff(ctx *repo.Context, revs Revisions, pathspecs []string) (DiffSet, error) {
+	names := DiffSetNames(revs)
+	results := make([][]string, len(names))
+	errs := make([]error, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = ReadDiffSet(ctx, revs, pathspecs, name)
+		}()
+	}
+	wg.Wait()
+
+	var set DiffSet
+	for i, name := range names {
+		if errs[i] != nil {
+			return DiffSet{}, errs[i]
+		}
+		switch name {
+		case "unstaged":
+			set.Unstaged = results[i]
+		case "staged":
+			set.Staged = results[i]
+		default:
+			set.All = results[i]
 		}
-		return lines, "staged", nil
 	}
+	return set, nil
+}
 
-	return lines, "working", nil
+// WithPathspecs appends pathspecs to a git command line, separated by "--"
+func WithPathspecs(args []string, pathspecs []string) []string {
+	if len(pathspecs) == 0 {
+		return args
+	}
+	args = append(args, "--")
+	return append(args, pathspecs...)
+}
+
+// MaxLineLength is the longest line of a diff or file that can be read, far above what even minified files hold
+const MaxLineLength = 1 << 30
+
+// SplitLines is a bufio.SplitFunc like bufio.ScanLines that only strips the "\n", keeping the "\r"
+// of CRLF line endings so patches built from the lines match the files byte for byte
+func SplitLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
 }
 
 // runGitDiff executes a git diff command and returns the output lines
-func runGitDiff(args ...string) ([]string, error) {
-	cmd := exec.Command(args[0], args[1:]...)
+func runGitDiff(cmd *exec.Cmd) ([]string, error) {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pipe: %w", err)
@@ -42,11 +129,18 @@ func runGitDiff(args ...string) ([]string, error) {
 	var lines []string
 	scanner := bufio.NewScanner(stdout)
 
+	// Minified and generated files can put far more than the default 64KB on one line
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineLength)
+	scanner.Split(SplitLines)
+
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
 	}
 
 	if err := scanner.Err(); err != nil {
+		// git may be blocked writing the rest; stop it so waiting can't hang
+		cmd.Process.Kill()
+		cmd.Wait()
 		return nil, fmt.Errorf("error reading diff: %w", err)
 	}
 
@@ -58,9 +152,11 @@ func runGitDiff(args ...string) ([]string, error) {
 	return lines, nil
 }
 
-// ReadUntrackedFiles reads untracked files using git ls-files
-func ReadUntrackedFiles() ([]string, error) {
-	cmd := exec.Command("git", "ls-files", "--others", "--exclude-standard")
+// ReadUntrackedFiles reads untracked files using git ls-files, limited to pathspecs if given
+// Returned paths are relative to the repository root
+func ReadUntrackedFiles(ctx *repo.Context, pathspecs []string) ([]string, error) {
+	args := WithPathspecs([]string{"ls-files", "--others", "--exclude-standard"}, pathspecs)
+	cmd := ctx.Command(args...)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pipe: %w", err)
@@ -78,6 +174,8 @@ func ReadUntrackedFiles() ([]string, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
 		return nil, fmt.Errorf("error reading untracked files: %w", err)
 	}
 
@@ -87,3 +185,35 @@ func ReadUntrackedFiles() ([]string, error) {
 
 	return files, nil
 }
+
+// ReadPatch reads a patch from a file, or from stdin when path is "-"
+func ReadPatch(path string) ([]string, error) {
+	var file *os.File
+	if path == "-" {
+		file = os.Stdin
+	} else {
+		var err error
+		file, err = os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open patch: %w", err)
+		}
+		defer file.Close()
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+
+	// Patches can contain long lines (e.g. minified files)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, MaxLineLength)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading patch: %w", err)
+	}
+
+	return lines, nil
+}
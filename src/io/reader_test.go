@@ -0,0 +1,66 @@
+package io
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gg/src/repo"
+)
+
+// newTestRepo creates a repository with one commit of name holding content
+func newTestRepo(t *testing.T, name, content string) *repo.Context {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "--", name},
+		{"-c", "user.name=gg", "-c", "user.email=gg@localhost", "commit", "--quiet", "-m", "base"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+
+	ctx, err := repo.DiscoverAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func TestReadDiffSetLongLine(t *testing.T) {
+	// A minified JSON file is a single line, far longer than bufio.Scanner's default 64KB limit
+	old := `{"items":[` + strings.Repeat(`"aaaaaaaaaa",`, 10000) + `"end"]}` + "\n"
+	ctx := newTestRepo(t, "data.json", old)
+	changed := strings.Replace(old, "end", "changed", 1)
+	if err := os.WriteFile(ctx.Path("data.json"), []byte(changed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := ReadDiffSet(ctx, Revisions{}, nil, "unstaged")
+	if err != nil {
+		t.Fatalf("ReadDiffSet: %v", err)
+	}
+	var removed, added string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "-{") {
+			removed = line[1:]
+		} else if strings.HasPrefix(line, "+{") {
+			added = line[1:]
+		}
+	}
+	if removed+"\n" != old || added+"\n" != changed {
+		t.Errorf("got lines of %d and %d bytes, want %d and %d", len(removed), len(added), len(old)-1, len(changed)-1)
+	}
+}
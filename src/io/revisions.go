@@ -0,0 +1,124 @@
+package io
+
+import (
+	"fmt"
+	"strings"
+
+	"gg/src/repo"
+)
+
+// Revisions describes what a diff compares, mirroring the revision arguments of git diff
+type Revisions struct {
+	Args   []string // Revision arguments as given on the command line, e.g. "HEAD~3" or "main...feature"
+	Cached bool     // Compare against the index instead of the working tree (--cached/--staged)
+}
+
+// IsDefault returns true when no revisions were given and gg shows the working tree state
+func (r Revisions) IsDefault() bool {
+	return len(r.Args) == 0 && !r.Cached
+}
+
+// IncludesWorkingTree returns true if one side of the comparison is the working tree
+func (r Revisions) IncludesWorkingTree() bool {
+	if r.Cached {
+		return false
+	}
+	switch len(r.Args) {
+	case 0:
+		return true
+	case 1:
+		// A..B and A...B name both sides explicitly
+		return !strings.Contains(r.Args[0], "..")
+	default:
+		return false
+	}
+}
+
+// DiffArgs returns the git diff arguments selecting this comparison
+func (r Revisions) DiffArgs() []string {
+	args := []string{"diff"}
+	if r.Cached {
+		args = append(args, "--cached")
+	}
+	return append(args, r.Args...)
+}
+
+// ResolveRange validates the revisions and returns a short label describing the
+// resolved comparison, e.g. "main@1a2b3c4...feature@5d6e7f8" or "HEAD~3@9f8e7d6..worktree"
+func ResolveRange(ctx *repo.Context, r Revisions) (string, error) {
+	if r.IsDefault() {
+		return "", nil
+	}
+
+	// Name of the right-hand side when it isn't a revision
+	target := "worktree"
+	if r.Cached {
+		target = "index"
+	}
+
+	switch len(r.Args) {
+	case 0:
+		// --cached on its own compares HEAD with the index
+		head, err := resolveRevision(ctx, "HEAD")
+		if err != nil {
+			return "", err
+		}
+		return head + ".." + target, nil
+
+	case 1:
+		arg := r.Args[0]
+		for _, sep := range []string{"...", ".."} {
+			if !strings.Contains(arg, sep) {
+				continue
+			}
+			sides := strings.SplitN(arg, sep, 2)
+			left, err := resolveRevision(ctx, sides[0])
+			if err != nil {
+				return "", err
+			}
+			right, err := resolveRevision(ctx, sides[1])
+			if err != nil {
+				return "", err
+			}
+			return left + sep + right, nil
+		}
+
+		rev, err := resolveRevision(ctx, arg)
+		if err != nil {
+			return "", err
+		}
+		return rev + ".." + target, nil
+
+	case 2:
+		left, err := resolveRevision(ctx, r.Args[0])
+		if err != nil {
+			return "", err
+		}
+		right, err := resolveRevision(ctx, r.Args[1])
+		if err != nil {
+			return "", err
+		}
+		return left + ".." + right, nil
+	}
+
+	return "", fmt.Errorf("too many revisions: %s", strings.Join(r.Args, " "))
+}
+
+// resolveRevision resolves a revision to "name@shorthash", defaulting an empty name to HEAD
+func resolveRevision(ctx *repo.Context, rev string) (string, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	output, err := ctx.Command("rev-parse", "--verify", "--quiet", "--short", rev+"^{commit}").Output()
+	if err != nil {
+		return "", fmt.Errorf("unknown revision: %s", rev)
+	}
+
+	hash := strings.TrimSpace(string(output))
+	if strings.HasPrefix(hash, rev) {
+		// Revision was already given as a hash
+		return hash, nil
+	}
+	return rev + "@" + hash, nil
+}
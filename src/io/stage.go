@@ -0,0 +1,125 @@
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gg/src/repo"
+)
+
+// ApplyToIndex applies a patch to the index with git apply --cached, leaving the working tree alone
+// With reverse set the patch is taken back out of the index, unstaging it
+func ApplyToIndex(ctx *repo.Context, patch string, reverse bool) error {
+	args := []string{"apply", "--cached", "--whitespace=nowarn"}
+	if reverse {
+		args = append(args, "--reverse")
+	}
+	cmd := ctx.Command(append(args, "-")...)
+	cmd.Stdin = strings.NewReader(patch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git apply failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// pathCommand prepares a git command taking file paths, which are matched literally rather than as globs
+func pathCommand(ctx *repo.Context, args ...string) *exec.Cmd {
+	return ctx.Command(append([]string{"--literal-pathspecs"}, args...)...)
+}
+
+// IntentToAdd records untracked paths in the index with no content (git add -N), so patches can be applied to them
+func IntentToAdd(ctx *repo.Context, paths ...string) error {
+	if output, err := pathCommand(ctx, append([]string{"add", "--intent-to-add", "--"}, paths...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git add failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// RemoveFromIndex removes paths from the index, keeping them in the working tree as untracked files
+func RemoveFromIndex(ctx *repo.Context, paths ...string) error {
+	if output, err := pathCommand(ctx, append([]string{"rm", "--cached", "--quiet", "--"}, paths...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git rm failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// StagePaths stages the whole content of paths with git add
+func StagePaths(ctx *repo.Context, paths ...string) error {
+	if output, err := pathCommand(ctx, append([]string{"add", "--"}, paths...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git add failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// UnstagePaths takes paths back out of the index to their HEAD version with git reset, keeping the working tree
+func UnstagePaths(ctx *repo.Context, paths ...string) error {
+	if output, err := pathCommand(ctx, append([]string{"reset", "--quiet", "--"}, paths...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git reset failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// DiscardPaths throws away the unstaged changes of tracked paths, restoring their index version with git checkout
+func DiscardPaths(ctx *repo.Context, paths ...string) error {
+	if output, err := pathCommand(ctx, append([]string{"checkout", "--"}, paths...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git checkout failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// DeleteUntracked removes untracked paths from the working tree with git clean
+func DeleteUntracked(ctx *repo.Context, paths ...string) error {
+	if output, err := pathCommand(ctx, append([]string{"clean", "--force", "--quiet", "--"}, paths...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git clean failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// IgnorePaths appends paths to the .gitignore at the root of the working tree
+// Each pattern is anchored to the root and escaped, so it matches exactly that path
+func IgnorePaths(ctx *repo.Context, paths ...string) error {
+	name := ctx.Path(".gitignore")
+	existing, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read .gitignore: %w", err)
+	}
+
+	var b strings.Builder
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	for _, path := range paths {
+		b.WriteString("/" + ignorePattern(path) + "\n")
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open .gitignore: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(b.String()); err != nil {
+		return fmt.Errorf("failed to write .gitignore: %w", err)
+	}
+	return nil
+}
+
+// ignorePattern escapes the characters of a path that .gitignore would read as glob syntax,
+// as well as trailing spaces, which git strips
+func ignorePattern(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`\*?[!#`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	pattern := b.String()
+	trimmed := strings.TrimRight(pattern, " ")
+	if trimmed != pattern {
+		pattern = trimmed + strings.Repeat(`\ `, len(pattern)-len(trimmed))
+	}
+	return pattern
+}
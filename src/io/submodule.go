@@ -0,0 +1,52 @@
+package io
+
+import (
+	"strconv"
+	"strings"
+
+	"gg/src/repo"
+)
+
+// maxSubmoduleLog caps the number of commits listed for a submodule change
+const maxSubmoduleLog = 100
+
+// ReadSubmoduleLog lists the commits between two recorded submodule commits
+// Lines start with ">" for commits only in newCommit and "<" for commits only in oldCommit
+func ReadSubmoduleLog(sub *repo.Context, oldCommit, newCommit string) ([]string, error) {
+	args := []string{"log", "--left-right", "--format=%m %h %s"}
+	switch {
+	case oldCommit != "" && newCommit != "":
+		args = append(args, "--max-count="+strconv.Itoa(maxSubmoduleLog), oldCommit+"..."+newCommit)
+	case newCommit != "":
+		// Newly added submodule: show the commits leading up to it
+		args = append(args, "--max-count="+strconv.Itoa(maxSubmoduleLog), newCommit)
+	default:
+		// Removed submodule: nothing new to list, show where it was
+		args = append(args, "--max-count=1", oldCommit)
+	}
+
+	output, err := sub.Command(args...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimRight(string(output), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// ReadSubmoduleDiff reads the file changes inside a submodule between its recorded commits
+// When worktree is true the new side is the submodule's working tree, which also covers dirty changes
+func ReadSubmoduleDiff(sub *repo.Context, oldCommit, newCommit string, worktree bool) ([]string, error) {
+	if oldCommit == "" {
+		oldCommit = emptyTreeHash
+	}
+
+	args := []string{"diff", oldCommit}
+	if !worktree && newCommit != "" {
+		args = append(args, newCommit)
+	}
+	return runGitDiff(sub.Command(args...))
+}
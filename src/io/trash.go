@@ -0,0 +1,181 @@
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gg/src/repo"
+)
+
+// TrashRefs is the ref namespace holding the content saved before each discard
+// refs/worktree refs belong to one worktree, like the paths they save, and still keep their commits from gc
+const TrashRefs = "refs/worktree/gg-trash/"
+
+// TrashLimit is the number of discards kept; older ones are dropped when a new one is saved
+const TrashLimit = 20
+
+// TrashEntry is the content of some paths saved before they were discarded
+type TrashEntry struct {
+	Ref     string    // Ref of the commit holding the saved content
+	Time    time.Time // When the content was discarded
+	Summary string    // What was discarded, e.g. "Discard changes to 3 files"
+	Paths   []string  // Saved paths; those missing from the commit didn't exist and are removed on restore
+}
+
+// SaveToTrash saves the working tree content of paths in a commit under TrashRefs, so discarding them can be undone
+// The commit's tree holds only the paths that exist; its message lists every path, quoted one per line
+func SaveToTrash(ctx *repo.Context, summary string, paths ...string) error {
+	// A temporary index that starts out empty collects the paths
+	dir, err := os.MkdirTemp("", "gg-trash-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(dir, "index"))
+
+	var existing []string
+	for _, path := range paths {
+		if _, err := os.Lstat(ctx.Path(path)); err == nil {
+			existing = append(existing, path)
+		}
+	}
+	if len(existing) > 0 {
+		// -f saves tracked files matching .gitignore too
+		cmd := pathCommand(ctx, append([]string{"add", "--force", "--"}, existing...)...)
+		cmd.Env = env
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to save discarded content: %s", bytes.TrimSpace(output))
+		}
+	}
+	cmd := ctx.Command("write-tree")
+	cmd.Env = env
+	tree, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to save discarded content: %w", err)
+	}
+
+	message := summary + "\n"
+	for _, path := range paths {
+		message += "\n" + strconv.Quote(path)
+	}
+	// The commits are private to gg, so they don't need the user's identity
+	cmd = ctx.Command("commit-tree", strings.TrimSpace(string(tree)), "-m", message)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=gg", "GIT_AUTHOR_EMAIL=gg@localhost",
+		"GIT_COMMITTER_NAME=gg", "GIT_COMMITTER_EMAIL=gg@localhost")
+	commit, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to save discarded content: %w", err)
+	}
+
+	// Nanosecond names sort in the order the discards happened
+	ref := fmt.Sprintf("%s%020d", TrashRefs, time.Now().UnixNano())
+	if output, err := ctx.Command("update-ref", ref, strings.TrimSpace(string(commit))).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to save discarded content: %s", bytes.TrimSpace(output))
+	}
+
+	// Drop the oldest discards beyond the limit
+	entries, err := ListTrash(ctx)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries[min(len(entries), TrashLimit):] {
+		ctx.Command("update-ref", "-d", entry.Ref).Run()
+	}
+	return nil
+}
+
+// ListTrash returns the saved discards, most recent first
+func ListTrash(ctx *repo.Context) ([]TrashEntry, error) {
+	output, err := ctx.Command("for-each-ref", "--sort=-refname",
+		"--format=%(refname)%00%(contents:subject)%00%(contents:body)%00", TrashRefs).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list discarded changes: %w", err)
+	}
+
+	// Each ref is three NUL-terminated fields followed by the newline for-each-ref ends it with
+	var entries []TrashEntry
+	fields := strings.Split(string(output), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		entry := TrashEntry{Ref: strings.TrimPrefix(fields[i], "\n"), Summary: fields[i+1]}
+		nanos, _ := strconv.ParseInt(strings.TrimPrefix(entry.Ref, TrashRefs), 10, 64)
+		entry.Time = time.Unix(0, nanos)
+		for _, line := range strings.Split(fields[i+2], "\n") {
+			if path, err := strconv.Unquote(line); err == nil {
+				entry.Paths = append(entry.Paths, path)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// RestoreTrash puts the saved content of a discard back in the working tree and drops it from the trash
+// Paths changed since the discard are saved first, so restoring can't lose work either
+func RestoreTrash(ctx *repo.Context, entry TrashEntry) error {
+	if changed := changedPaths(ctx, entry.Paths); len(changed) > 0 {
+		if err := SaveToTrash(ctx, "Overwritten by restoring: "+entry.Summary, changed...); err != nil {
+			return err
+		}
+	}
+
+	// Paths in the saved tree are written back; the others didn't exist at the time
+	output, err := ctx.Command("ls-tree", "-r", "-z", "--name-only", "--full-tree", entry.Ref).Output()
+	if err != nil {
+		return fmt.Errorf("failed to read discarded content: %w", err)
+	}
+	saved := make(map[string]bool)
+	for _, path := range strings.Split(string(output), "\x00") {
+		saved[path] = true
+	}
+
+	var restore []string
+	for _, path := range entry.Paths {
+		if saved[path] {
+			restore = append(restore, path)
+		} else if err := os.Remove(ctx.Path(path)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	if len(restore) > 0 {
+		args := append([]string{"restore", "--source=" + entry.Ref, "--worktree", "--"}, restore...)
+		if output, err := pathCommand(ctx, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("git restore failed: %s", bytes.TrimSpace(output))
+		}
+	}
+
+	if output, err := ctx.Command("update-ref", "-d", entry.Ref).CombinedOutput(); err != nil {
+		return fmt.Errorf("git update-ref failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// changedPaths returns the paths whose working tree content differs from the index, untracked ones included
+func changedPaths(ctx *repo.Context, paths []string) []string {
+	args := append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, paths...)
+	output, err := pathCommand(ctx, args...).Output()
+	if err != nil {
+		return nil
+	}
+
+	// Entries are "XY path", followed by the original path for renames
+	var changed []string
+	entries := strings.Split(string(output), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		if entry[1] != ' ' {
+			changed = append(changed, entry[3:])
+		}
+		if strings.ContainsAny(entry[:2], "RC") {
+			i++
+		}
+	}
+	return changed
+}
@@ -0,0 +1,168 @@
+package loader
+
+import (
+	"sync"
+
+	"gg/src/cli"
+	"gg/src/diff"
+	"gg/src/io"
+	"gg/src/models"
+	"gg/src/repo"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// batchSize is how many files are parsed before they're delivered to the UI
+const batchSize = 50
+
+// ProgressMsg delivers files parsed so far, to be appended to a diff set ("unstaged", "staged" or "all")
+type ProgressMsg struct {
+	Set   string
+	Files []models.FileDiff
+	next  <-chan tea.Msg
+}
+
+// Next returns the command waiting for the message after this one
+func (msg ProgressMsg) Next() tea.Cmd {
+	return wait(msg.next)
+}
+
+// DoneMsg ends a load with the complete diff sets, in the order their files were delivered
+// and with every file's stage marked. Err is set if a git command failed
+type DoneMsg struct {
+	UnstagedFiles []models.FileDiff
+	StagedFiles   []models.FileDiff
+	AllFiles      []models.FileDiff
+	Err           error
+}
+
+// Start returns a command that reads and parses the diff sets in the background
+// The git commands run concurrently, and files arrive as ProgressMsgs while later ones are still parsing
+func Start(ctx *repo.Context, opts cli.Options) tea.Cmd {
+	return func() tea.Msg {
+		messages := make(chan tea.Msg)
+		go run(ctx, opts, io.DiffSetNames(opts.Revisions), messages)
+		return <-messages
+	}
+}
+
+// Load reads and parses the diff sets, returning once everything is loaded
+func Load(ctx *repo.Context, opts cli.Options) DoneMsg {
+	return load(ctx, opts, io.DiffSetNames(opts.Revisions))
+}
+
+// LoadPaths re-diffs only the given worktree paths, for merging into loaded sets with Merge
+// The staged set compares HEAD with the index, which worktree edits leave alone, so it isn't read
+// The paths stand in for the pathspecs, so they must lie inside them; the watcher asks for a full refresh otherwise
+func LoadPaths(ctx *repo.Context, opts cli.Options, paths []string) DoneMsg {
+	opts.Paths = paths
+	var names []string
+	for _, name := range io.DiffSetNames(opts.Revisions) {
+		if name != "staged" {
+			names = append(names, name)
+		}
+	}
+	return load(ctx, opts, names)
+}
+
+// load runs a load of the named diff sets to completion
+func load(ctx *repo.Context, opts cli.Options, names []string) DoneMsg {
+	messages := make(chan tea.Msg)
+	go run(ctx, opts, names, messages)
+	for msg := range messages {
+		if done, ok := msg.(DoneMsg); ok {
+			return done
+		}
+	}
+	return DoneMsg{}
+}
+
+// wait returns a command receiving the next message of a load
+func wait(messages <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-messages
+	}
+}
+
+// run loads the named diff sets and the untracked files concurrently, sending ProgressMsgs and a final DoneMsg
+func run(ctx *repo.Context, opts cli.Options, names []string, messages chan tea.Msg) {
+	sets := make(map[string][]models.FileDiff)
+	var mu sync.Mutex
+	var firstErr error
+
+	// deliver records files in their set and sends them, under one lock so the
+	// final sets keep the order in which the UI received the files
+	deliver := func(set string, files []models.FileDiff) {
+		if len(files) == 0 {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		sets[set] = append(sets[set], files...)
+		messages <- ProgressMsg{Set: set, Files: files, next: messages}
+	}
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	var tracked, wg sync.WaitGroup
+	for _, name := range names {
+		// Submodules are diffed against the working tree unless the comparison excludes it
+		worktree := name == "unstaged" || (name == "all" && opts.Revisions.IncludesWorkingTree())
+
+		tracked.Add(1)
+		go func() {
+			defer tracked.Done()
+			lines, err := io.ReadDiffSet(ctx, opts.Revisions, opts.Paths, name)
+			if err != nil {
+				fail(err)
+				return
+			}
+			for _, chunk := range diff.SplitFiles(lines, batchSize) {
+				files := diff.ParseDiffIntoFiles(chunk)
+				if name == "unstaged" {
+					// Unmerged files only show up as such between the index and the working tree
+					diff.LoadConflicts(ctx, files)
+				}
+				// Read submodule logs, and their nested file diffs if requested
+				deliver(name, diff.ExpandSubmodules(ctx, files, worktree, opts.RecurseSubmodules))
+			}
+		}()
+	}
+
+	// Untracked files only exist in the working tree
+	if opts.Revisions.IncludesWorkingTree() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			untracked, err := io.ReadUntrackedFiles(ctx, opts.Paths)
+			if err != nil {
+				fail(err)
+				return
+			}
+			var batches [][]models.FileDiff
+			for start := 0; start < len(untracked); start += batchSize {
+				batches = append(batches, diff.CreateUntrackedFileDiffs(ctx, untracked[start:min(start+batchSize, len(untracked))]))
+			}
+
+			// Untracked files are listed after the tracked changes, as in git status
+			tracked.Wait()
+			for _, files := range batches {
+				deliver("unstaged", files)
+				deliver("all", files)
+			}
+		}()
+	}
+
+	tracked.Wait()
+	wg.Wait()
+
+	unstaged, staged, all := sets["unstaged"], sets["staged"], sets["all"]
+	diff.MarkStages(unstaged, staged, all)
+	messages <- DoneMsg{UnstagedFiles: unstaged, StagedFiles: staged, AllFiles: all, Err: firstErr}
+	close(messages)
+}
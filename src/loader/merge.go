@@ -0,0 +1,109 @@
+package loader
+
+import (
+	"slices"
+	"strings"
+
+	"gg/src/models"
+)
+
+// CanMerge reports whether re-diffing paths is enough to refresh the loaded sets
+// Renames, copies and submodules pair up or expand paths beyond the ones that changed,
+// so touching one of them needs a full reload
+func CanMerge(paths []string, sets ...[]models.FileDiff) bool {
+	for _, set := range sets {
+		for _, file := range set {
+			if !touches(paths, file) {
+				continue
+			}
+			if file.Header.IsRename || file.Header.IsCopy || file.Submodule != nil || file.Parent != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Merge replaces the files of a set touched by paths with their fresh diffs
+// Every other entry is kept as it is, along with its highlight cache. Replaced files stay in place,
+// new tracked files go before the untracked ones and new untracked files at the end
+func Merge(current, fresh []models.FileDiff, paths []string) []models.FileDiff {
+	freshByName := make(map[string]models.FileDiff, len(fresh))
+	for _, file := range fresh {
+		freshByName[file.Name] = file
+	}
+
+	result := make([]models.FileDiff, 0, len(current)+len(fresh))
+	placed := make(map[string]bool)
+	for _, file := range current {
+		if !touches(paths, file) {
+			result = append(result, file)
+			continue
+		}
+		if update, ok := freshByName[file.Name]; ok {
+			keepHighlighting(&update, file)
+			result = append(result, update)
+			placed[file.Name] = true
+		}
+	}
+
+	// Insert files that weren't in the set before
+	var tracked, untracked []models.FileDiff
+	for _, file := range fresh {
+		if placed[file.Name] {
+			continue
+		}
+		if file.Status == "Untracked" {
+			untracked = append(untracked, file)
+		} else {
+			tracked = append(tracked, file)
+		}
+	}
+	end := len(result)
+	for end > 0 && result[end-1].Status == "Untracked" {
+		end--
+	}
+	result = slices.Insert(result, end, tracked...)
+	return append(result, untracked...)
+}
+
+// KeepHighlighting hands the syntax highlighting state of current files to their reloaded versions
+// Highlighted lines are cached by their text, so the cache stays valid when a file's content changes
+func KeepHighlighting(current, fresh []models.FileDiff) {
+	byName := make(map[string]*models.FileDiff, len(current))
+	for i := range current {
+		byName[current[i].Name] = &current[i]
+	}
+	for i := range fresh {
+		if old, ok := byName[fresh[i].Name]; ok {
+			keepHighlighting(&fresh[i], *old)
+		}
+	}
+}
+
+// keepHighlighting copies the lexer and highlight cache of old into file,
+// along with the conflict resolutions picked so far
+func keepHighlighting(file *models.FileDiff, old models.FileDiff) {
+	if file.Conflict != nil && old.Conflict != nil {
+		file.Conflict.KeepChoices(old.Conflict)
+	}
+	if file.Lexer != nil || old.Lexer == nil {
+		return
+	}
+	file.Lexer = old.Lexer
+	file.Style = old.Style
+	file.Formatter = old.Formatter
+	file.HighlightCache = old.HighlightCache
+}
+
+// touches reports whether any of the changed paths is the file, one of its old paths, or a directory holding it
+func touches(paths []string, file models.FileDiff) bool {
+	for _, path := range paths {
+		for _, name := range []string{file.Name, file.Header.OldPath} {
+			if name != "" && (name == path || strings.HasPrefix(name, path+"/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// FileActionMsg asks for a batch action on files picked in the stats table
+type FileActionMsg struct {
+	Action  string   // "stage", "unstage", "discard", "delete" or "ignore"
+	Paths   []string // Files the action applies to
+	Skipped int      // Picked files the action doesn't apply to, for the notice
+}
+
+// fileActionKeys maps the stats view keys to their batch actions
+var fileActionKeys = map[string]string{"S": "stage", "U": "unstage", "X": "discard", "D": "delete", "I": "ignore"}
+
+// Describe returns what the action is about to do, e.g. "Discard changes to 3 files"
+func (a FileActionMsg) Describe() string {
+	count := fmt.Sprintf("%d files", len(a.Paths))
+	if len(a.Paths) == 1 {
+		count = a.Paths[0]
+	}
+	switch a.Action {
+	case "stage":
+		return "Stage " + count
+	case "unstage":
+		return "Unstage " + count
+	case "discard":
+		return "Discard changes to " + count
+	case "delete":
+		return "Delete untracked " + count
+	default:
+		return "Add " + count + " to .gitignore"
+	}
+}
+
+// Destructive reports whether the action loses work, so it has to be confirmed first
+func (a FileActionMsg) Destructive() bool {
+	return a.Action == "discard" || a.Action == "delete"
+}
+
+// appliesTo reports whether a batch action can act on a file
+// Files inside submodules belong to another repository and are always left out
+func (a FileActionMsg) appliesTo(file FileDiff) bool {
+	if file.Parent != "" {
+		return false
+	}
+	switch a.Action {
+	case "stage":
+		return file.Status != "Unmerged"
+	case "unstage":
+		return file.Stage == "staged" || file.Stage == "both"
+	case "discard":
+		// Only tracked files have a version in the index to go back to
+		return file.Status != "Untracked" && file.Status != "Unmerged" && file.Submodule == nil &&
+			(file.Stage == "unstaged" || file.Stage == "both")
+	default:
+		return file.Status == "Untracked"
+	}
+}
+
+// ToggleStatsSelection picks or unpicks the highlighted file of the stats table
+func (m *Model) ToggleStatsSelection() {
+	name, ok := m.StatsTable.HighlightedRow().Data["name"].(string)
+	if !ok || name == "" {
+		return
+	}
+	if m.StatsSelected == nil {
+		m.StatsSelected = make(map[string]bool)
+	}
+	if m.StatsSelected[name] {
+		delete(m.StatsSelected, name)
+	} else {
+		m.StatsSelected[name] = true
+	}
+	m.ViewChanged = true
+}
+
+// fileAction starts a batch action on the picked files, or the highlighted one when none are picked
+// Destructive actions wait for confirmation; a notice says when the action applies to none of the files
+func (m *Model) fileAction(action string) tea.Cmd {
+	if !m.HasRepository() || m.Range != "" {
+		m.Notice = "Files can only be changed when the working tree is compared"
+		m.ResizeViewports()
+		return nil
+	}
+
+	picked := m.StatsSelected
+	if len(picked) == 0 {
+		if name, ok := m.StatsTable.HighlightedRow().Data["name"].(string); ok && name != "" {
+			picked = map[string]bool{name: true}
+		}
+	}
+
+	msg := FileActionMsg{Action: action}
+	for _, file := range m.Files {
+		if !picked[file.Name] {
+			continue
+		}
+		if msg.appliesTo(file) {
+			msg.Paths = append(msg.Paths, file.Name)
+		} else {
+			msg.Skipped++
+		}
+	}
+
+	if len(msg.Paths) == 0 {
+		m.Notice = fmt.Sprintf("Nothing to %s in the selected files", action)
+		m.ResizeViewports()
+		return nil
+	}
+
+	// The picked files stay picked until the action runs, so a cancelled one can be retried
+	if msg.Destructive() {
+		m.Confirm = &msg
+		m.ResizeViewports()
+		return nil
+	}
+	m.StatsSelected = nil
+	m.ViewChanged = true
+	return func() tea.Msg { return msg }
+}
+
+// updateConfirm handles the key answering a confirmation prompt: "y" runs the action, anything else cancels it
+func (m Model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	action := *m.Confirm
+	m.Confirm = nil
+	if msg.String() != "y" {
+		m.Notice = "Cancelled"
+		m.ResizeViewports()
+		return m, nil
+	}
+	m.StatsSelected = nil
+	m.ViewChanged = true
+	m.ResizeViewports()
+	return m, func() tea.Msg { return action }
+}
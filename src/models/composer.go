@@ -0,0 +1,192 @@
+package models
+
+import (
+	"strings"
+
+	"gg/src/io"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Composer is the commit screen: a message editor, the commit options, and the output of the last git commit
+type Composer struct {
+	Open    bool
+	Editor  textarea.Model
+	Output  viewport.Model   // What git commit and its hooks printed, scrolled when focused
+	Options io.CommitOptions // Amend, sign-off and no-verify toggles
+	Draft   string           // Message typed before amend filled in the last one, put back when amend is turned off
+	Focus   string           // Pane the keys go to: "message" or "output"
+	Result  string           // Outcome of the last commit: "" before any, "ok" or "failed"
+	Staged  []io.StagedFile  // Everything the commit will include, read apart from the diff sets, which the pathspecs limit
+	started bool             // Editor and output pane have been created
+}
+
+// LoadLastMessageMsg asks for the last commit's message, to amend it
+type LoadLastMessageMsg struct{}
+
+// LastMessageMsg carries the last commit's message for the composer
+type LastMessageMsg struct {
+	Message string
+	Err     error
+}
+
+// LoadStagedMsg asks for the staged files to be read for the composer
+type LoadStagedMsg struct{}
+
+// StagedLoadedMsg carries the staged files read for the composer
+type StagedLoadedMsg struct {
+	Files []io.StagedFile
+	Err   error
+}
+
+// CommitMsg asks for the composed message to be committed
+type CommitMsg struct {
+	Message string
+	Options io.CommitOptions
+}
+
+// CommitDoneMsg reports the output of git commit, hooks included, and whether it failed
+type CommitDoneMsg struct {
+	Output string
+	Err    error
+}
+
+// openComposer shows the commit screen, keeping the message left there last time
+func (m *Model) openComposer() tea.Cmd {
+	if !m.Composer.started {
+		editor := textarea.New()
+		editor.Placeholder = "Subject line, a blank line, then the body"
+		editor.ShowLineNumbers = false
+		editor.CharLimit = 0
+		editor.Cursor.SetMode(cursor.CursorStatic)
+		m.Composer.Editor = editor
+		m.Composer.Output = viewport.New(0, 0)
+		m.Composer.started = true
+	}
+	m.Composer.Open = true
+	m.Composer.Focus = "message"
+	m.resizeComposer()
+	return tea.Batch(m.Composer.Editor.Focus(), func() tea.Msg { return LoadStagedMsg{} })
+}
+
+// ComposerHeights splits the height of the commit screen between the message editor,
+// the staged files and the output pane; the rest goes to one-line headers
+func (m *Model) ComposerHeights() (editor, staged, output int) {
+	height := m.Height - 1 - m.BannerHeight() // Help bar and banner
+	editor = max(height*2/5, 3)
+	staged = max(height/5, 1)
+	output = max(height-4-editor-staged, 1) // Title, subject guide, staged and output headers
+	return editor, staged, output
+}
+
+// resizeComposer fits the editor and output pane to the terminal
+func (m *Model) resizeComposer() {
+	if !m.Composer.started {
+		return
+	}
+	editor, _, output := m.ComposerHeights()
+	m.Composer.Editor.SetWidth(m.Width)
+	m.Composer.Editor.SetHeight(editor)
+	m.Composer.Output.Width = m.Width
+	m.Composer.Output.Height = output
+}
+
+// updateComposer handles keys while the commit screen is open
+// Keys that aren't commands go to the focused pane: typing into the editor or scrolling the output
+func (m Model) updateComposer(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.Notice != "" {
+		m.Notice = ""
+		m.ResizeViewports()
+	}
+
+	c := &m.Composer
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		c.Open = false
+	case "tab":
+		if c.Focus == "message" {
+			c.Focus = "output"
+			c.Editor.Blur()
+		} else {
+			c.Focus = "message"
+			cmd = c.Editor.Focus()
+		}
+	case "alt+a":
+		// Amending starts from the last commit's message; turning it off brings back what was typed before
+		c.Options.Amend = !c.Options.Amend
+		if c.Options.Amend {
+			c.Draft = c.Editor.Value()
+			return m, func() tea.Msg { return LoadLastMessageMsg{} }
+		}
+		c.Editor.SetValue(c.Draft)
+	case "alt+s":
+		c.Options.SignOff = !c.Options.SignOff
+	case "alt+n":
+		c.Options.NoVerify = !c.Options.NoVerify
+	case "ctrl+s":
+		if m.Busy != "" {
+			break
+		}
+		if strings.TrimSpace(c.Editor.Value()) == "" {
+			m.Notice = "Write a commit message first"
+			m.ResizeViewports()
+			break
+		}
+		commit := CommitMsg{Message: c.Editor.Value(), Options: c.Options}
+		return m, func() tea.Msg { return commit }
+	default:
+		if c.Focus == "output" {
+			c.Output, cmd = c.Output.Update(msg)
+		} else {
+			c.Editor, cmd = c.Editor.Update(msg)
+		}
+	}
+	return m, cmd
+}
+
+// amendWith fills the editor with the last commit's message, or turns amend back off if there is none
+func (m *Model) amendWith(msg LastMessageMsg) {
+	if msg.Err != nil {
+		m.Composer.Options.Amend = false
+		m.Notice = msg.Err.Error()
+		m.ResizeViewports()
+		return
+	}
+	m.Composer.Editor.SetValue(msg.Message)
+}
+
+// showStaged lists the staged files read for the composer
+func (m *Model) showStaged(msg StagedLoadedMsg) {
+	m.Composer.Staged = msg.Files
+	if msg.Err != nil {
+		m.Notice = msg.Err.Error()
+		m.ResizeViewports()
+	}
+}
+
+// FinishCommit shows the output of git commit; a successful commit clears the message and options for the next one
+func (m *Model) FinishCommit(msg CommitDoneMsg) {
+	c := &m.Composer
+	c.Output.SetContent(strings.TrimRight(msg.Output, "\n"))
+	c.Output.GotoTop()
+	if msg.Err != nil {
+		c.Result = "failed"
+		return
+	}
+	c.Result = "ok"
+	c.Editor.Reset()
+	c.Draft = ""
+	c.Options = io.CommitOptions{}
+}
+
+// Subject returns the first line of the message being composed
+func (c *Composer) Subject() string {
+	subject, _, _ := strings.Cut(c.Editor.Value(), "\n")
+	return subject
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+// ConflictRegion is a stretch of a three-way merge: lines that merged cleanly, or a conflict between the sides
+type ConflictRegion struct {
+	Conflict bool
+	Lines    []string // Cleanly merged lines
+	Ours     []string // Our side of a conflict (index stage 2)
+	Base     []string // The common ancestor's lines (index stage 1)
+	Theirs   []string // Their side of a conflict (index stage 3)
+	Choice   string   // Resolution: "" (unresolved), "ours", "theirs" or "both" (ours then theirs)
+}
+
+// Conflict is the three-way merge of an unmerged file, along with the resolution picked so far
+type Conflict struct {
+	Regions         []ConflictRegion
+	HasBase         bool // The file has a common ancestor; files added on both sides don't
+	TrailingNewline bool // The merged file ends with a newline
+	Active          int  // Index of the selected conflict, counting conflicting regions only
+}
+
+// ResultLine is one line of the merged result
+type ResultLine struct {
+	Text     string
+	Conflict int    // Index of the conflict the line comes from, -1 for cleanly merged lines
+	Side     string // "ours", "base" or "theirs" for lines of a conflict, "marker" for unresolved conflict markers
+}
+
+// Count returns the number of conflicting regions
+func (c *Conflict) Count() int {
+	count := 0
+	for _, region := range c.Regions {
+		if region.Conflict {
+			count++
+		}
+	}
+	return count
+}
+
+// Unresolved returns the number of conflicts without a choice yet
+func (c *Conflict) Unresolved() int {
+	count := 0
+	for _, region := range c.Regions {
+		if region.Conflict && region.Choice == "" {
+			count++
+		}
+	}
+	return count
+}
+
+// Region returns the nth conflicting region, or nil if there is none
+func (c *Conflict) Region(n int) *ConflictRegion {
+	for i := range c.Regions {
+		if !c.Regions[i].Conflict {
+			continue
+		}
+		if n == 0 {
+			return &c.Regions[i]
+		}
+		n--
+	}
+	return nil
+}
+
+// Choose resolves the active conflict with "ours", "theirs" or "both"
+// Choosing the current resolution again undoes it
+func (c *Conflict) Choose(choice string) {
+	region := c.Region(c.Active)
+	if region == nil {
+		return
+	}
+	if region.Choice == choice {
+		region.Choice = ""
+	} else {
+		region.Choice = choice
+	}
+}
+
+// KeepChoices carries over the resolutions and selection of old when both merges have the same conflicts,
+// so reloading an unmerged file doesn't lose what was picked
+func (c *Conflict) KeepChoices(old *Conflict) {
+	if len(c.Regions) != len(old.Regions) {
+		return
+	}
+	for i, region := range c.Regions {
+		previous := old.Regions[i]
+		if region.Conflict != previous.Conflict || !slices.Equal(region.Ours, previous.Ours) ||
+			!slices.Equal(region.Base, previous.Base) || !slices.Equal(region.Theirs, previous.Theirs) {
+			return
+		}
+	}
+	for i := range c.Regions {
+		c.Regions[i].Choice = old.Regions[i].Choice
+	}
+	c.Active = old.Active
+}
+
+// ResultLines builds the merged file from the clean regions and the chosen sides
+// Unresolved conflicts keep git's diff3 markers around all three sides
+func (c *Conflict) ResultLines() []ResultLine {
+	var lines []ResultLine
+	n := 0
+	for _, region := range c.Regions {
+		lines = append(lines, c.regionLines(region, n)...)
+		if region.Conflict {
+			n++
+		}
+	}
+	return lines
+}
+
+// Start returns the index in ResultLines of the first line of conflict n
+// A conflict resolved to nothing starts where the line after it is
+func (c *Conflict) Start(n int) int {
+	start, k := 0, 0
+	for _, region := range c.Regions {
+		if region.Conflict {
+			if k == n {
+				break
+			}
+			k++
+		}
+		start += len(c.regionLines(region, k))
+	}
+	return start
+}
+
+// regionLines returns the result lines of a region; n is its index among the conflicts
+func (c *Conflict) regionLines(region ConflictRegion, n int) []ResultLine {
+	var lines []ResultLine
+	add := func(texts []string, conflict int, side string) {
+		for _, text := range texts {
+			lines = append(lines, ResultLine{Text: text, Conflict: conflict, Side: side})
+		}
+	}
+
+	if !region.Conflict {
+		add(region.Lines, -1, "")
+		return lines
+	}
+
+	switch region.Choice {
+	case "ours":
+		add(region.Ours, n, "ours")
+	case "theirs":
+		add(region.Theirs, n, "theirs")
+	case "both":
+		add(region.Ours, n, "ours")
+		add(region.Theirs, n, "theirs")
+	default:
+		add([]string{"<<<<<<< ours"}, n, "marker")
+		add(region.Ours, n, "ours")
+		if c.HasBase {
+			add([]string{"||||||| base"}, n, "marker")
+			add(region.Base, n, "base")
+		}
+		add([]string{"======="}, n, "marker")
+		add(region.Theirs, n, "theirs")
+		add([]string{">>>>>>> theirs"}, n, "marker")
+	}
+	return lines
+}
+
+// Result returns the content of the merged file
+func (c *Conflict) Result() string {
+	lines := c.ResultLines()
+	if len(lines) == 0 {
+		return ""
+	}
+
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	result := strings.Join(texts, "\n")
+	if c.TrailingNewline {
+		result += "\n"
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LineKind classifies a line inside a hunk
+type LineKind int
+
+const (
+	LineContext LineKind = iota // Unchanged line, present on both sides
+	LineAdded                   // Line only in the new file
+	LineRemoved                 // Line only in the old file
+)
+
+// DiffLine is a single line of a hunk
+type DiffLine struct {
+	Kind      LineKind
+	Text      string // Line content without the diff prefix, keeping the "\r" of a CRLF line ending
+	OldNum    int    // Line number in the old file, 0 for added lines
+	NewNum    int    // Line number in the new file, 0 for removed lines
+	NoNewline bool   // Followed by "\ No newline at end of file"
+}
+
+// Display returns the line's text as shown on screen, without the "\r" of a CRLF line ending
+// Text keeps it so patches built from the line still match the file
+func (l DiffLine) Display() string {
+	return strings.TrimSuffix(l.Text, "\r")
+}
+
+// Hunk is one "@@" block of a file diff
+type Hunk struct {
+	Header   string // The raw "@@ -a,b +c,d @@ section" line
+	OldStart int    // First line of the hunk in the old file
+	OldCount int    // Number of old file lines covered by the hunk
+	NewStart int    // First line of the hunk in the new file
+	NewCount int    // Number of new file lines covered by the hunk
+	Section  string // Heading after the closing "@@", usually the enclosing function
+	Lines    []DiffLine
+}
+
+// FormatHeader builds a "@@ -a,b +c,d @@ section" line from the hunk's ranges
+// Counts of one are omitted, matching git's output
+func (h Hunk) FormatHeader() string {
+	formatRange := func(start, count int) string {
+		if count == 1 {
+			return fmt.Sprintf("%d", start)
+		}
+		return fmt.Sprintf("%d,%d", start, count)
+	}
+
+	header := fmt.Sprintf("@@ -%s +%s @@", formatRange(h.OldStart, h.OldCount), formatRange(h.NewStart, h.NewCount))
+	if h.Section != "" {
+		header += " " + h.Section
+	}
+	return header
+}
+
+// FileHeader holds the file-level metadata of a diff
+type FileHeader struct {
+	OldPath    string   // Path before the change, empty for added files
+	NewPath    string   // Path after the change, empty for deleted files
+	OldMode    string   // File mode before the change, if reported
+	NewMode    string   // File mode after the change, if reported
+	Similarity int      // Rename or copy similarity percentage
+	IsNew      bool     // "new file mode" or --- /dev/null
+	IsDeleted  bool     // "deleted file mode" or +++ /dev/null
+	IsRename   bool     // "rename from"/"rename to"
+	IsCopy     bool     // "copy from"/"copy to"
+	IsBinary   bool     // "Binary files ... differ" or "GIT binary patch"
+	IsCombined bool     // "diff --cc" output for unmerged paths
+	Lines      []string // Raw header lines ("diff --git", "index", "---", "+++", ...) for rebuilding patches
+}
+
+// Path returns the path the file is known by: the new path, or the old one for deleted files
+func (h FileHeader) Path() string {
+	if h.NewPath != "" {
+		return h.NewPath
+	}
+	return h.OldPath
+}
+
+// Row is one row of the side-by-side view, holding indexes into a hunk's Lines
+// Old and New are -1 when the row has no line on that side; context rows use the same index for both
+type Row struct {
+	Old int
+	New int
+}
+
+// Rows aligns a hunk for side-by-side display
+// Each run of removed and added lines is paired row by row, with the leftovers of the longer side padded
+func (h Hunk) Rows() []Row {
+	var rows []Row
+	var removed, added []int
+
+	flush := func() {
+		for i := 0; i < max(len(removed), len(added)); i++ {
+			row := Row{Old: -1, New: -1}
+			if i < len(removed) {
+				row.Old = removed[i]
+			}
+			if i < len(added) {
+				row.New = added[i]
+			}
+			rows = append(rows, row)
+		}
+		removed, added = removed[:0], added[:0]
+	}
+
+	for i, line := range h.Lines {
+		switch line.Kind {
+		case LineRemoved:
+			// A removal after additions starts a new change block
+			if len(added) > 0 {
+				flush()
+			}
+			removed = append(removed, i)
+		case LineAdded:
+			added = append(added, i)
+		default:
+			flush()
+			rows = append(rows, Row{Old: i, New: i})
+		}
+	}
+	flush()
+
+	return rows
+}
+
+// LineRef identifies a line of a file diff by its hunk and its index in the hunk
+type LineRef struct {
+	Hunk int
+	Line int
+}
+
+// Span is a byte range [Start, End) within a line's Text
+type Span struct {
+	Start int
+	End   int
+}
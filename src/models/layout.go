@@ -0,0 +1,54 @@
+package models
+
+// RowKind classifies a row of the diff layout
+type RowKind int
+
+const (
+	RowBanner     RowKind = iota // Pre-rendered full-width line: hunk headers, commit headers, summaries
+	RowSplit                     // Old and new lines side by side
+	RowUnified                   // A single line of the unified layout
+	RowHunkHeader                // A hunk's "@@" line, highlighted when the hunk is selected
+)
+
+// LayoutRow is one screen row of the diff view
+// Rows only reference hunk lines; their text is highlighted and formatted when the row becomes visible
+type LayoutRow struct {
+	Kind     RowKind
+	Banner   string // Rendered text of a RowBanner
+	Hunk     int    // Index of the hunk the row belongs to (all kinds but RowBanner)
+	Old      int    // Index of the old side's line in the hunk, -1 if none (RowSplit)
+	New      int    // Index of the new side's line in the hunk, -1 if none (RowSplit)
+	Line     int    // Index of the line in the hunk (RowUnified)
+	Part     int    // Which wrapped segment of the line(s) the row shows, 0 when not wrapping
+	OldSpans []Span // Changed spans of the old line, for intra-line emphasis
+	NewSpans []Span // Changed spans of the new line (RowUnified uses OldSpans for its line)
+}
+
+// LayoutKey identifies what a layout was computed for; a layout is reused until its key changes
+type LayoutKey struct {
+	File      *FileDiff // The file's data; a reload swaps in a new copy even when nothing changed
+	Set       string    // Diff type and path, which identify the file across reloads
+	Path      string
+	Width     int
+	Unified   bool
+	Wrap      bool
+	IntraLine string
+	Query     string
+}
+
+// DiffLayout is the row layout of the active file, computed once per file, width and display option
+type DiffLayout struct {
+	Key     LayoutKey
+	Rows    []LayoutRow
+	Longest int // Widest line in cells, bounding the horizontal scroll offset
+}
+
+// HunkStart returns the index of the first row of a hunk, its header when it has one, or -1 if it has no rows
+func (l *DiffLayout) HunkStart(hunk int) int {
+	for i, row := range l.Rows {
+		if row.Kind != RowBanner && row.Hunk == hunk {
+			return i
+		}
+	}
+	return -1
+}
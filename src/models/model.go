@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -24,6 +26,30 @@ func (m *Model) InitFilterInput(placeholder string) {
 // FilterAppliedMsg is sent when a filter has been applied and views need updating
 type FilterAppliedMsg struct{}
 
+// DiffTypeChangedMsg is sent when the user switches between unstaged, staged and all changes
+type DiffTypeChangedMsg struct{}
+
+// SubmodulesToggledMsg is sent when submodule expansion is toggled and the diff needs reloading
+type SubmodulesToggledMsg struct{}
+
+// ResolveConflictMsg asks for an unmerged file to be written with its resolved content and staged
+type ResolveConflictMsg struct {
+	Path    string
+	Content string
+}
+
+// StageLinesMsg asks for changed lines of a file to be staged, or unstaged when they're from the staged changes
+// The file is copied so a refresh arriving in between can't change what gets applied
+type StageLinesMsg struct {
+	File    FileDiff
+	Lines   map[LineRef]bool // Added and removed lines to apply
+	Unstage bool
+	What    string // What was selected, for the notice: "hunk 2/5", "3 lines"
+}
+
+// horizontalScrollStep is how many columns < and > scroll the diff
+const horizontalScrollStep = 8
+
 // Update handles Bubble Tea messages and updates the model
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
@@ -76,6 +102,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, cmd
 	}
 
+	// A visual selection keeps the keys until it's staged or cancelled
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.Visual.Active {
+		return m.updateVisual(keyMsg)
+	}
+
+	// A confirmation prompt takes the next key as its answer
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.Confirm != nil {
+		return m.updateConfirm(keyMsg)
+	}
+
+	// The trash browser keeps the keys until it's closed
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.Trash.Open {
+		return m.updateTrash(keyMsg)
+	}
+
+	// The commit screen takes every key, as most of them are typed into the message
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.Composer.Open {
+		return m.updateComposer(keyMsg)
+	}
+
 	// Handle viewport/table updates FIRST based on current view mode
 	// This allows tables to consume key events for scrolling before we process them
 	if m.ViewMode == "log" {
@@ -92,6 +138,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		keyStr := msg.String()
 
+		// A notice only lasts until the next key
+		if m.Notice != "" {
+			m.Notice = ""
+			m.ResizeViewports()
+		}
+
 		// Global quit - but only 'q' and 'ctrl+c' quit globally
 		// 'esc' now clears filters/search in context
 		switch keyStr {
@@ -107,8 +159,135 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, tea.Quit
 		case "a":
-			// Toggle auto-reload
-			m.AutoReloadEnabled = !m.AutoReloadEnabled
+			// Toggle auto-reload (only meaningful when diffing a repository)
+			if m.HasRepository() {
+				m.AutoReloadEnabled = !m.AutoReloadEnabled
+			}
+		case "t":
+			// Cycle between unstaged, staged and all changes
+			// A revision range, patch or path comparison has nothing to cycle through
+			if m.Range == "" && m.HasRepository() {
+				m.SelectDiffType(m.NextDiffType())
+				return m, func() tea.Msg { return DiffTypeChangedMsg{} }
+			}
+		case "e":
+			// Toggle expanding submodules into their own file diffs (once the initial load is done)
+			if m.HasRepository() && !m.Loading {
+				m.ExpandSubmodules = !m.ExpandSubmodules
+				return m, func() tea.Msg { return SubmodulesToggledMsg{} }
+			}
+		case "i":
+			// Toggle emphasizing changed words or changed characters
+			if m.IntraLineMode == "char" {
+				m.IntraLineMode = "word"
+			} else {
+				m.IntraLineMode = "char"
+			}
+		case "v":
+			// Switch between the side-by-side and unified layouts, overriding the automatic choice
+			if m.IsUnified() {
+				m.Layout = "split"
+			} else {
+				m.Layout = "unified"
+			}
+			m.ResizeViewports()
+		case ">", "<":
+			// Scroll both diff columns horizontally (clamped to the longest line when rendering)
+			if m.ViewMode == "diff" && !m.WrapLines {
+				if keyStr == ">" {
+					m.ScrollX += horizontalScrollStep
+				} else {
+					m.ScrollX = max(m.ScrollX-horizontalScrollStep, 0)
+				}
+			}
+		case "w":
+			// Toggle soft-wrapping long lines
+			m.WrapLines = !m.WrapLines
+			m.ScrollX = 0
+		case "m":
+			// Switch an unmerged file between the conflict view and its combined diff
+			if m.ViewMode == "diff" && m.ActiveTab < len(m.Files) && m.Files[m.ActiveTab].Conflict != nil {
+				m.ShowCombined = !m.ShowCombined
+			}
+		case "]", "[":
+			if m.ViewMode != "diff" || m.ActiveTab >= len(m.Files) {
+				break
+			}
+			if conflict := m.ActiveConflict(); conflict != nil {
+				// Move between the conflicts of an unmerged file, scrolling the merged result to the selected one
+				if conflict.Count() > 0 {
+					if keyStr == "]" {
+						conflict.Active = min(conflict.Active+1, conflict.Count()-1)
+					} else {
+						conflict.Active = max(conflict.Active-1, 0)
+					}
+					m.LeftViewport.YOffset = max(conflict.Start(conflict.Active)-2, 0)
+				}
+			} else if hunks := len(m.Files[m.ActiveTab].Hunks); hunks > 0 && m.DiffLayout != nil {
+				// Select the next or previous hunk and scroll its header to the top
+				if keyStr == "]" {
+					m.HunkCursor = min(m.HunkCursor+1, hunks-1)
+				} else {
+					m.HunkCursor = max(m.HunkCursor-1, 0)
+				}
+				if start := m.DiffLayout.HunkStart(m.HunkCursor); start >= 0 {
+					m.LeftViewport.SetYOffset(start)
+					m.RightViewport.YOffset = m.LeftViewport.YOffset
+				}
+			}
+		case "S":
+			// Stage the selected hunk, or unstage it when viewing staged changes
+			if m.ViewMode == "diff" {
+				return m, m.stageHunk()
+			} else if m.ViewMode == "stats" {
+				return m, m.fileAction("stage")
+			}
+		case "U", "X", "D", "I":
+			// Unstage, discard, delete or ignore the files picked in the stats table
+			if m.ViewMode == "stats" {
+				return m, m.fileAction(fileActionKeys[keyStr])
+			}
+		case " ":
+			// Pick the highlighted file of the stats table for a batch action
+			if m.ViewMode == "stats" {
+				m.ToggleStatsSelection()
+			}
+		case "V":
+			// Select individual lines to stage or unstage
+			if m.ViewMode == "diff" && m.ActiveConflict() == nil {
+				m.startVisual()
+			}
+		case "O", "T", "B":
+			// Resolve the selected conflict with our side, their side, or both
+			if conflict := m.ActiveConflict(); m.ViewMode == "diff" && conflict != nil {
+				conflict.Choose(map[string]string{"O": "ours", "T": "theirs", "B": "both"}[keyStr])
+			}
+		case "R":
+			// Write the merged result and mark the file resolved, once every conflict has a resolution
+			if conflict := m.ActiveConflict(); m.ViewMode == "diff" && conflict != nil {
+				if n := conflict.Unresolved(); n > 0 {
+					m.Notice = fmt.Sprintf("%d conflicts left to resolve in %s", n, m.Files[m.ActiveTab].Name)
+					m.ResizeViewports()
+					return m, nil
+				}
+				resolve := ResolveConflictMsg{Path: m.Files[m.ActiveTab].Name, Content: conflict.Result()}
+				return m, func() tea.Msg { return resolve }
+			}
+		case "c":
+			// Compose a commit from the staged changes
+			if m.HasRepository() {
+				return m, m.openComposer()
+			}
+		case "z":
+			// Undo the most recent discard
+			if m.HasRepository() {
+				return m, func() tea.Msg { return RestoreTrashMsg{} }
+			}
+		case "Z":
+			// Browse the saved discards to restore one
+			if m.HasRepository() {
+				return m, func() tea.Msg { return OpenTrashMsg{} }
+			}
 		case "s":
 			// Toggle stats view
 			if m.ViewMode == "stats" {
@@ -117,8 +296,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.ViewMode = "stats"
 			}
 		case "l":
-			// Show log view
-			if m.ViewMode != "log" {
+			// Show log view (unavailable for patches and path comparisons, which have no repository)
+			if m.ViewMode != "log" && m.HasRepository() {
 				m.ViewMode = "log"
 				m.ViewChanged = true
 			}
@@ -234,32 +413,91 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case TrashLoadedMsg:
+		m.openTrash(msg)
+
+	case LastMessageMsg:
+		m.amendWith(msg)
+
+	case StagedLoadedMsg:
+		m.showStaged(msg)
+
 	case tea.WindowSizeMsg:
 		m.Width = msg.Width
 		m.Height = msg.Height
 
-		// Calculate viewport height: total - tabs (always shown) - help line
-		viewportHeight := msg.Height - 2 // 1 for tabs, 1 for help
-
-		// Full width split 50/50 between left and right columns
-		leftColWidth := (msg.Width - 1) / 2             // Left column (accounting for center divider)
-		rightColWidth := (msg.Width - 1) - leftColWidth // Right column gets remaining space
-
 		if !m.Ready {
-			m.LeftViewport = viewport.New(leftColWidth, viewportHeight)
-			m.RightViewport = viewport.New(rightColWidth, viewportHeight)
+			m.LeftViewport = viewport.New(0, 0)
+			m.RightViewport = viewport.New(0, 0)
 			m.Ready = true
-		} else {
-			m.LeftViewport.Width = leftColWidth
-			m.RightViewport.Width = rightColWidth
-			m.LeftViewport.Height = viewportHeight
-			m.RightViewport.Height = viewportHeight
 		}
+		m.ResizeViewports()
 	}
 
 	return m, cmd
 }
 
+// stageHunk returns a command staging or unstaging the selected hunk of the active file
+// When the hunk can't be applied to the index, a notice says why and no command is returned
+func (m *Model) stageHunk() tea.Cmd {
+	if m.ActiveTab >= len(m.Files) {
+		return nil
+	}
+	file := m.Files[m.ActiveTab]
+	if reason := m.stageBlocked(&file); reason != "" {
+		m.Notice = reason
+		m.ResizeViewports()
+		return nil
+	}
+
+	hunk := min(m.HunkCursor, len(file.Hunks)-1)
+	lines := make(map[LineRef]bool)
+	for i := range file.Hunks[hunk].Lines {
+		lines[LineRef{Hunk: hunk, Line: i}] = true
+	}
+	stage := StageLinesMsg{
+		File: file, Lines: lines, Unstage: m.StageAction() == "unstage",
+		What: fmt.Sprintf("hunk %d/%d", hunk+1, len(file.Hunks)),
+	}
+	return func() tea.Msg { return stage }
+}
+
+// stageBlocked explains why the changes of a file can't be staged or unstaged from the diff view, or returns ""
+func (m *Model) stageBlocked(file *FileDiff) string {
+	switch {
+	case m.StageAction() == "":
+		return "Changes can only be staged from the unstaged or staged changes (t)"
+	case file.Status == "Unmerged":
+		return "Resolve the conflicts of " + file.Name + " first"
+	case file.Parent != "":
+		return "Files inside submodules can't be staged from here"
+	case file.Submodule != nil || len(file.Hunks) == 0:
+		return "No lines to " + m.StageAction() + " in " + file.Name
+	}
+	return ""
+}
+
+// ResizeViewports sizes the diff columns for the current layout and repository state banner
+// Side by side, the width is split 50/50 around the center divider; unified, the left viewport takes it all
+func (m *Model) ResizeViewports() {
+	// Calculate viewport height: total - tabs (always shown) - help line - state banner
+	viewportHeight := m.Height - 2 - m.BannerHeight()
+	m.LeftViewport.Height = viewportHeight
+	m.RightViewport.Height = viewportHeight
+	m.resizeComposer()
+
+	if m.IsUnified() {
+		m.LeftViewport.Width = m.Width
+		m.RightViewport.Width = 0
+		return
+	}
+
+	leftColWidth := (m.Width - 1) / 2             // Left column (accounting for center divider)
+	rightColWidth := (m.Width - 1) - leftColWidth // Right column gets remaining space
+	m.LeftViewport.Width = leftColWidth
+	m.RightViewport.Width = rightColWidth
+}
+
 // View returns empty string - actual view rendering is done by appWrapper to avoid circular imports
 func (m Model) View() string {
 	return ""
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// VisualSelection is a range of diff rows picked to stage or unstage individual lines
+// Rows index into the active DiffLayout; the selection is dropped when the layout is rebuilt, unless only the file was reloaded
+type VisualSelection struct {
+	Active bool
+	Anchor int    // Row where the selection started
+	Cursor int    // Row the selection was extended to, moved with the arrow keys
+	Side   string // Side-by-side column the selection takes lines from: "" for both, "old" or "new"
+}
+
+// visualSides are the columns a side-by-side selection can take lines from, left to right
+var visualSides = []string{"old", "", "new"}
+
+// Contains reports whether a layout row lies within the selection
+func (v VisualSelection) Contains(row int) bool {
+	return v.Active && row >= min(v.Anchor, v.Cursor) && row <= max(v.Anchor, v.Cursor)
+}
+
+// startVisual enters visual selection on the first changed line of the selected hunk in view
+func (m *Model) startVisual() {
+	if m.ActiveTab >= len(m.Files) || m.DiffLayout == nil || len(m.DiffLayout.Rows) == 0 {
+		return
+	}
+	if reason := m.stageBlocked(&m.Files[m.ActiveTab]); reason != "" {
+		m.Notice = reason
+		m.ResizeViewports()
+		return
+	}
+
+	rows := m.DiffLayout.Rows
+	start := min(m.LeftViewport.YOffset, len(rows)-1)
+	end := min(start+m.LeftViewport.Height, len(rows))
+	cursor := start
+	for i := start; i < end; i++ {
+		if rows[i].Hunk == m.HunkCursor && len(m.rowLines(rows[i])) > 0 {
+			cursor = i
+			break
+		}
+	}
+	m.Visual = VisualSelection{Active: true, Anchor: cursor, Cursor: cursor}
+}
+
+// updateVisual handles keys while a visual selection is active
+// Only keys that extend, act on or leave the selection are taken; others are ignored
+func (m Model) updateVisual(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.Notice != "" {
+		m.Notice = ""
+		m.ResizeViewports()
+	}
+
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "esc", "V":
+		m.Visual = VisualSelection{}
+	case "up", "k":
+		m.moveVisualCursor(-1)
+	case "down", "j":
+		m.moveVisualCursor(1)
+	case "pgup", "b":
+		m.moveVisualCursor(-m.LeftViewport.Height)
+	case "pgdown", " ", "f":
+		m.moveVisualCursor(m.LeftViewport.Height)
+	case "left", "h":
+		m.moveVisualSide(-1)
+	case "right", "l":
+		m.moveVisualSide(1)
+	case "S":
+		cmd := m.stageSelection()
+		m.Visual = VisualSelection{}
+		return m, cmd
+	}
+	return m, nil
+}
+
+// moveVisualCursor moves the moving end of the selection by delta rows, scrolling to keep it on screen
+func (m *Model) moveVisualCursor(delta int) {
+	rows := len(m.DiffLayout.Rows)
+	m.Visual.Cursor = max(min(m.Visual.Cursor+delta, rows-1), 0)
+
+	if m.Visual.Cursor < m.LeftViewport.YOffset {
+		m.LeftViewport.SetYOffset(m.Visual.Cursor)
+	} else if m.Visual.Cursor >= m.LeftViewport.YOffset+m.LeftViewport.Height {
+		m.LeftViewport.SetYOffset(m.Visual.Cursor - m.LeftViewport.Height + 1)
+	}
+	m.RightViewport.YOffset = m.LeftViewport.YOffset
+}
+
+// moveVisualSide narrows a side-by-side selection to the removed or added lines of its rows, or widens it back
+// to both: the columns go old, both, new from left to right. The unified layout has a single column
+func (m *Model) moveVisualSide(delta int) {
+	if m.IsUnified() {
+		return
+	}
+	i := slices.Index(visualSides, m.Visual.Side)
+	m.Visual.Side = visualSides[max(min(i+delta, len(visualSides)-1), 0)]
+}
+
+// SelectedLines returns the added and removed lines within the visual selection
+// A side-by-side row selects the changed lines on the selection's side, or on both when it has none
+func (m *Model) SelectedLines() map[LineRef]bool {
+	lines := make(map[LineRef]bool)
+	if !m.Visual.Active || m.DiffLayout == nil {
+		return lines
+	}
+
+	rows := m.DiffLayout.Rows
+	from := max(min(m.Visual.Anchor, m.Visual.Cursor), 0)
+	to := min(max(m.Visual.Anchor, m.Visual.Cursor), len(rows)-1)
+	for i := from; i <= to; i++ {
+		for _, ref := range m.rowLines(rows[i]) {
+			lines[ref] = true
+		}
+	}
+	return lines
+}
+
+// rowLines returns the added and removed lines shown on a layout row
+func (m *Model) rowLines(row LayoutRow) []LineRef {
+	var indexes []int
+	switch row.Kind {
+	case RowSplit:
+		switch m.Visual.Side {
+		case "old":
+			indexes = []int{row.Old}
+		case "new":
+			indexes = []int{row.New}
+		default:
+			indexes = []int{row.Old, row.New}
+		}
+	case RowUnified:
+		indexes = []int{row.Line}
+	default:
+		return nil
+	}
+
+	hunk := m.Files[m.ActiveTab].Hunks[row.Hunk]
+	var refs []LineRef
+	for _, idx := range indexes {
+		if idx >= 0 && hunk.Lines[idx].Kind != LineContext {
+			refs = append(refs, LineRef{Hunk: row.Hunk, Line: idx})
+		}
+	}
+	return refs
+}
+
+// stageSelection returns a command staging or unstaging the lines in the visual selection
+func (m *Model) stageSelection() tea.Cmd {
+	lines := m.SelectedLines()
+	if len(lines) == 0 {
+		m.Notice = "No added or removed lines selected"
+		m.ResizeViewports()
+		return nil
+	}
+
+	what := fmt.Sprintf("%d lines", len(lines))
+	if len(lines) == 1 {
+		what = "1 line"
+	}
+	stage := StageLinesMsg{File: m.Files[m.ActiveTab], Lines: lines, Unstage: m.StageAction() == "unstage", What: what}
+	return func() tea.Msg { return stage }
+}
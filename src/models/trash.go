@@ -0,0 +1,65 @@
+package models
+
+import (
+	"gg/src/io"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// TrashBrowser lists the saved discards so any of them can be restored
+type TrashBrowser struct {
+	Open    bool
+	Entries []io.TrashEntry // Saved discards, most recent first
+	Cursor  int             // Index of the selected entry
+}
+
+// OpenTrashMsg asks for the saved discards to be loaded into the trash browser
+type OpenTrashMsg struct{}
+
+// TrashLoadedMsg carries the saved discards read for the trash browser
+type TrashLoadedMsg struct {
+	Entries []io.TrashEntry
+	Err     error
+}
+
+// RestoreTrashMsg asks for a saved discard to be put back in the working tree
+type RestoreTrashMsg struct {
+	Entry *io.TrashEntry // nil restores the most recent discard
+}
+
+// openTrash shows the trash browser with the loaded discards, or says why there is nothing to show
+func (m *Model) openTrash(msg TrashLoadedMsg) {
+	switch {
+	case msg.Err != nil:
+		m.Notice = msg.Err.Error()
+	case len(msg.Entries) == 0:
+		m.Notice = "No discarded changes to restore"
+	default:
+		m.Trash = TrashBrowser{Open: true, Entries: msg.Entries}
+	}
+	m.ResizeViewports()
+}
+
+// updateTrash handles keys while the trash browser is open
+func (m Model) updateTrash(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.Notice != "" {
+		m.Notice = ""
+		m.ResizeViewports()
+	}
+
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "esc", "Z":
+		m.Trash = TrashBrowser{}
+	case "up", "k":
+		m.Trash.Cursor = max(m.Trash.Cursor-1, 0)
+	case "down", "j":
+		m.Trash.Cursor = min(m.Trash.Cursor+1, len(m.Trash.Entries)-1)
+	case "enter":
+		restore := RestoreTrashMsg{Entry: &m.Trash.Entries[m.Trash.Cursor]}
+		m.Trash = TrashBrowser{}
+		return m, func() tea.Msg { return restore }
+	}
+	return m, nil
+}
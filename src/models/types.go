@@ -3,11 +3,15 @@ package models
 import (
 	"path/filepath"
 	"strings"
+	"sync"
+
+	"gg/src/repo"
 
 	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/formatters"
 	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/evertras/bubble-table/table"
@@ -15,14 +19,39 @@ import (
 
 type FileDiff struct {
 	Name           string
-	Content        []string
-	HighlightCache map[int]string   // Cache: line index -> highlighted line
-	Lexer          chroma.Lexer     // Cached lexer for this file type
-	Style          *chroma.Style    // Cached style
-	Formatter      chroma.Formatter // Cached formatter
-	Additions      int              // Number of added lines
-	Deletions      int              // Number of deleted lines
-	Status         string           // File status: "Modified", "New", "Deleted", "Renamed"
+	Header         FileHeader        // Paths, modes and flags from the diff header
+	Hunks          []Hunk            // Parsed hunks; untracked files have a single all-added hunk
+	HighlightCache map[string]string // Cache: source line -> highlighted line
+	Lexer          chroma.Lexer      // Cached lexer for this file type
+	Style          *chroma.Style     // Cached style
+	Formatter      chroma.Formatter  // Cached formatter
+	Additions      int               // Number of added lines
+	Deletions      int               // Number of deleted lines
+	Status         string            // File status: "Modified", "New", "Deleted", "Renamed", "Copied", "Unmerged", "Untracked"
+	Stage          string            // Where the changes live: "unstaged", "staged", or "both"
+	Commit         *CommitInfo       // Commit metadata from a format-patch preamble, nil for plain diffs
+	Submodule      *SubmoduleInfo    // Submodule commit change, nil for regular files
+	Parent         string            // Path of the submodule this file was expanded from, empty for top-level files
+	Conflict       *Conflict         // Three-way merge of an unmerged file, nil when it isn't unmerged or can't be merged as text
+}
+
+// SubmoduleInfo describes a change to the commit recorded for a submodule
+type SubmoduleInfo struct {
+	OldCommit string   // Commit recorded before, empty when the submodule was added
+	NewCommit string   // Commit recorded after, empty when the submodule was removed
+	Dirty     bool     // Submodule working tree has uncommitted changes
+	Log       []string // git log --left-right between the commits; "<" lines were removed, ">" lines added
+	Error     string   // Why the log couldn't be read, e.g. the submodule isn't checked out
+	Expanded  bool     // Nested file diffs were added as tabs after this one
+}
+
+// CommitInfo holds the commit metadata found in a git format-patch mail header
+type CommitInfo struct {
+	Hash    string   // Commit hash from the "From <hash>" mbox line
+	Author  string   // "From:" header
+	Date    string   // "Date:" header
+	Subject string   // "Subject:" header, continuation lines joined
+	Body    []string // Commit message body, without the diffstat
 }
 
 // CalculateStats computes additions and deletions for a file
@@ -30,31 +59,40 @@ func (f *FileDiff) CalculateStats() {
 	f.Additions = 0
 	f.Deletions = 0
 
-	for _, line := range f.Content {
-		if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
-			f.Additions++
-		} else if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---") {
-			f.Deletions++
+	for _, hunk := range f.Hunks {
+		for _, line := range hunk.Lines {
+			switch line.Kind {
+			case LineAdded:
+				f.Additions++
+			case LineRemoved:
+				f.Deletions++
+			}
 		}
 	}
 }
 
+// lexerCache maps file extensions to their lexers
+var lexerCache sync.Map
+
 // InitSyntaxHighlighting initializes the lexer, style, and formatter for a file
 func (f *FileDiff) InitSyntaxHighlighting() {
 	if f.Lexer != nil {
 		return // Already initialized
 	}
 
-	// Get lexer based on file extension
+	// Get lexer based on file extension; looking one up scans every lexer, so reuse them
 	ext := filepath.Ext(f.Name)
-	f.Lexer = lexers.Get(ext)
-
-	if f.Lexer == nil {
-		f.Lexer = lexers.Fallback
+	if cached, ok := lexerCache.Load(ext); ok {
+		f.Lexer = cached.(chroma.Lexer)
+	} else {
+		f.Lexer = lexers.Get(ext)
+		if f.Lexer == nil {
+			f.Lexer = lexers.Fallback
+		}
+		f.Lexer = chroma.Coalesce(f.Lexer)
+		lexerCache.Store(ext, f.Lexer)
 	}
 
-	f.Lexer = chroma.Coalesce(f.Lexer)
-
 	// Cache style and formatter
 	f.Style = styles.Get("monokai")
 	if f.Style == nil {
@@ -62,13 +100,14 @@ func (f *FileDiff) InitSyntaxHighlighting() {
 	}
 
 	f.Formatter = formatters.TTY16m
-	f.HighlightCache = make(map[int]string)
+	f.HighlightCache = make(map[string]string)
 }
 
 // HighlightLine highlights a single line using cached lexer/style/formatter
-func (f *FileDiff) HighlightLine(lineIdx int, code string) string {
+// Lines are cached by their text, so identical lines are only highlighted once
+func (f *FileDiff) HighlightLine(code string) string {
 	// Check cache first
-	if cached, exists := f.HighlightCache[lineIdx]; exists {
+	if cached, exists := f.HighlightCache[code]; exists {
 		return cached
 	}
 
@@ -90,18 +129,138 @@ func (f *FileDiff) HighlightLine(lineIdx int, code string) string {
 	result := strings.TrimRight(buf.String(), "\n")
 
 	// Cache the result
-	f.HighlightCache[lineIdx] = result
+	f.HighlightCache[code] = result
 
 	return result
 }
 
+// IsUnified returns true if the diff is shown as a single column instead of side by side
+func (m *Model) IsUnified() bool {
+	if m.Layout == "" {
+		return m.Width < m.UnifiedWidth
+	}
+	return m.Layout == "unified"
+}
+
+// BannerHeight returns the number of lines taken by the repository state and notice banner
+func (m *Model) BannerHeight() int {
+	if m.RepoState.Describe() == "" && m.Notice == "" && m.Confirm == nil && m.Busy == "" {
+		return 0
+	}
+	return 1
+}
+
+// ActiveConflict returns the three-way merge of the active file when it's shown in the conflict view
+func (m *Model) ActiveConflict() *Conflict {
+	if m.ShowCombined || m.ActiveTab >= len(m.Files) {
+		return nil
+	}
+	return m.Files[m.ActiveTab].Conflict
+}
+
+// StageAction returns what staging a hunk of the shown diff does: "stage" for unstaged changes,
+// "unstage" for staged ones, or "" when the diff can't be applied to the index
+func (m *Model) StageAction() string {
+	if !m.HasRepository() || m.Range != "" {
+		return ""
+	}
+	switch m.DiffType {
+	case "unstaged":
+		return "stage"
+	case "staged":
+		return "unstage"
+	default:
+		return ""
+	}
+}
+
+// DiffTypes lists the selectable diff types in the order they are cycled through
+var DiffTypes = []string{"unstaged", "staged", "all"}
+
+// SelectDiffType switches the active file set to the given diff type
+func (m *Model) SelectDiffType(diffType string) {
+	m.DiffType = diffType
+	m.SyncFiles()
+
+	m.ActiveTab = 0
+	m.DiffSearch.Matches = nil
+	m.DiffSearch.CurrentMatch = 0
+}
+
+// SyncFiles points Files at the set of the active diff type after the sets changed,
+// keeping the selected tab when it still exists
+func (m *Model) SyncFiles() {
+	switch m.DiffType {
+	case "staged":
+		m.Files = m.StagedFiles
+	case "all", "range", "patch", "noindex":
+		// Explicit revision ranges, patches and path comparisons are loaded into the all set
+		m.Files = m.AllFiles
+	default:
+		m.DiffType = "unstaged"
+		m.Files = m.UnstagedFiles
+	}
+	m.ActiveTab = max(min(m.ActiveTab, len(m.Files)-1), 0)
+
+	// Tell the user why the view is empty
+	if len(m.Files) == 0 {
+		switch {
+		case m.Loading:
+			m.NoDiffMessage = "Loading changes..."
+		case m.DiffType == "staged":
+			m.NoDiffMessage = "No staged changes"
+		case m.DiffType == "all" || m.DiffType == "range" || m.DiffType == "patch" || m.DiffType == "noindex":
+			m.NoDiffMessage = "No changes to display"
+		default:
+			m.NoDiffMessage = "No unstaged changes"
+		}
+	} else {
+		m.NoDiffMessage = ""
+	}
+}
+
+// NextDiffType returns the diff type that follows the current one
+func (m *Model) NextDiffType() string {
+	if m.PatchSource != "" {
+		// A patch has a single diff type
+		return "patch"
+	}
+	if m.NoIndex != "" {
+		// So does a comparison of two paths
+		return "noindex"
+	}
+	if m.Range != "" {
+		// A revision range has a single diff type
+		return "range"
+	}
+	for i, t := range DiffTypes {
+		if t == m.DiffType {
+			return DiffTypes[(i+1)%len(DiffTypes)]
+		}
+	}
+	return DiffTypes[0]
+}
+
+// HasRepository returns true when gg is diffing a git repository
+// rather than showing a patch or comparing paths outside git
+func (m *Model) HasRepository() bool {
+	return m.Repo != nil
+}
+
+// HasChanges returns true if any of the diff sets contains files
+func (m *Model) HasChanges() bool {
+	return len(m.UnstagedFiles) > 0 || len(m.StagedFiles) > 0 || len(m.AllFiles) > 0
+}
+
 // SearchMatch represents a match position in diff view search
 type SearchMatch struct {
-	LineIdx int // Index in the content array
-	Col     int // Column position in the line
+	Hunk int // Index of the hunk in the file
+	Line int // Index of the line in the hunk
+	Col  int // Column position in the line
 }
 
 type Model struct {
+	Repo              *repo.Context // Repository being diffed, nil for patches and --no-index comparisons
 	LeftViewport      viewport.Model
 	RightViewport     viewport.Model
 	Files             []FileDiff
@@ -109,20 +268,47 @@ type Model struct {
 	Ready             bool
 	Width             int
 	Height            int
-	ViewMode          string      // "diff", "stats", or "log"
-	NoDiffMessage     string      // Message to display when there's no diff
-	DiffType          string      // "working", "staged", or "none"
-	StatsTable        table.Model // Scrollable stats table
-	LogTable          table.Model // Scrollable log table
-	AutoReloadEnabled bool        // Toggle for automatic reload on git changes
-	ViewChanged       bool        // Flag to indicate view has changed
+	ViewMode          string          // "diff", "stats", or "log"
+	NoDiffMessage     string          // Message to display when there's no diff
+	DiffType          string          // "unstaged", "staged", "all", "range", "patch", "noindex", or "none"
+	Range             string          // Resolved revision range label, empty when showing the working tree
+	Pathspecs         []string        // Pathspecs given after "--", scoping diff, log and watcher
+	PatchSource       string          // Patch file being shown ("-" for stdin), empty when diffing the repository
+	NoIndex           string          // Label of the two paths compared with --no-index, empty when diffing the repository
+	UnstagedFiles     []FileDiff      // Index vs working tree (plus untracked files)
+	StagedFiles       []FileDiff      // HEAD vs index
+	AllFiles          []FileDiff      // HEAD vs working tree (plus untracked files)
+	StatsTable        table.Model     // Scrollable stats table
+	LogTable          table.Model     // Scrollable log table
+	AutoReloadEnabled bool            // Toggle for automatic reload on git changes
+	WatchBackend      string          // How changes are detected for auto-reload: "fsnotify" or "poll", empty without a watcher
+	ExpandSubmodules  bool            // Add submodules' own file diffs as tabs
+	IntraLineMode     string          // Granularity of changed-text emphasis: "word" (default) or "char"
+	Layout            string          // Diff layout: "" (automatic by width), "split" or "unified"
+	UnifiedWidth      int             // Terminal width below which the automatic layout is unified (0 disables)
+	ScrollX           int             // Horizontal scroll offset of the diff columns, shared by both panes
+	WrapLines         bool            // Soft-wrap long lines instead of scrolling horizontally
+	DiffLayout        *DiffLayout     // Row layout of the active file, rebuilt when the file, width or display options change
+	ViewChanged       bool            // Flag to indicate view has changed
+	Loading           bool            // Diff sets are still being read and parsed in the background
+	RepoState         repo.State      // Operation in progress (merge, rebase, ...) shown in a banner above the help bar
+	Notice            string          // Feedback on the last action (e.g. a failed git command), shown in the banner until the next key
+	ShowCombined      bool            // Show unmerged files as their combined diff instead of the conflict view
+	HunkCursor        int             // Index of the selected hunk in the active file, the one staging acts on
+	Visual            VisualSelection // Rows selected to stage individual lines
+	StatsSelected     map[string]bool // Files picked in the stats table for batch actions, by name
+	Confirm           *FileActionMsg  // Destructive action waiting for the user to confirm it
+	Busy              string          // Git command running in the background, shown with the spinner
+	Spinner           spinner.Model   // Animates Busy
+	Trash             TrashBrowser    // Saved discards, browsed to restore one
+	Composer          Composer        // Commit screen
 
 	// Filter/Search state
-	FilterMode    string            // "", "author", "path", "date_from", "date_to", "search", "status", "extension"
-	FilterInput   textinput.Model   // Text input for entering filter values
-	LogFilters    LogFilterState    // Active filters for log view
-	DiffSearch    DiffSearchState   // Search state for diff view
-	StatsFilters  StatsFilterState  // Active filters for stats view
+	FilterMode   string           // "", "author", "path", "date_from", "date_to", "search", "status", "extension"
+	FilterInput  textinput.Model  // Text input for entering filter values
+	LogFilters   LogFilterState   // Active filters for log view
+	DiffSearch   DiffSearchState  // Search state for diff view
+	StatsFilters StatsFilterState // Active filters for stats view
 }
 
 // LogFilterState holds active filters for the log view
@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Context holds the locations of the repository gg runs in, resolved once at startup
+// All git commands run from Toplevel, so every path gg handles is relative to the repository root
+type Context struct {
+	Toplevel  string // Root of the working tree
+	GitDir    string // Per-worktree git directory (.git, .git/worktrees/<name>, or .git/modules/<name>)
+	CommonDir string // Git directory shared by all worktrees, holding refs and objects
+	Prefix    string // Directory gg was started from, relative to Toplevel ("" at the root)
+}
+
+// Discover resolves the repository containing the current directory using git rev-parse
+// Works from subdirectories, in linked worktrees (where .git is a file) and in submodules
+func Discover() (*Context, error) {
+	return DiscoverAt("")
+}
+
+// DiscoverAt resolves the repository containing dir, or the current directory if dir is empty
+func DiscoverAt(dir string) (*Context, error) {
+	cmd := exec.Command("git", "rev-parse", "--path-format=absolute",
+		"--show-toplevel", "--git-dir", "--git-common-dir", "--show-prefix")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("not a git repository (or any of the parent directories)")
+	}
+
+	// One value per line; the prefix line is empty at the repository root
+	lines := strings.Split(string(output), "\n")
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("unexpected git rev-parse output: %q", string(output))
+	}
+
+	return &Context{
+		Toplevel:  lines[0],
+		GitDir:    lines[1],
+		CommonDir: lines[2],
+		Prefix:    strings.TrimSuffix(lines[3], "/"),
+	}, nil
+}
+
+// Submodule returns the context of the submodule checked out at path (relative to the root)
+// Returns an error if the submodule isn't initialized, since git would find this repository instead
+func (c *Context) Submodule(path string) (*Context, error) {
+	dir := c.Path(path)
+	sub, err := DiscoverAt(dir)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Clean(sub.Toplevel) != filepath.Clean(dir) {
+		return nil, fmt.Errorf("submodule %s is not checked out", path)
+	}
+	return sub, nil
+}
+
+// Command returns a git command that runs from the repository root
+func (c *Context) Command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = c.Toplevel
+	return cmd
+}
+
+// Path returns the absolute path of a path relative to the repository root
+func (c *Context) Path(rel string) string {
+	return filepath.Join(c.Toplevel, filepath.FromSlash(rel))
+}
+
+// GitPath returns the absolute path of a file in the per-worktree git directory (e.g. "index", "HEAD")
+func (c *Context) GitPath(name string) string {
+	return filepath.Join(c.GitDir, filepath.FromSlash(name))
+}
+
+// CommonPath returns the absolute path of a file in the shared git directory (e.g. "refs/heads")
+func (c *Context) CommonPath(name string) string {
+	return filepath.Join(c.CommonDir, filepath.FromSlash(name))
+}
+
+// ResolvePathspecs rewrites pathspecs given relative to the starting directory so they apply from the root
+// Pathspecs using git's ":" magic syntax are passed through unchanged
+func (c *Context) ResolvePathspecs(pathspecs []string) []string {
+	if c.Prefix == "" || len(pathspecs) == 0 {
+		return pathspecs
+	}
+
+	resolved := make([]string, 0, len(pathspecs))
+	for _, spec := range pathspecs {
+		if strings.HasPrefix(spec, ":") {
+			resolved = append(resolved, spec)
+			continue
+		}
+		resolved = append(resolved, filepath.ToSlash(filepath.Join(c.Prefix, spec)))
+	}
+	return resolved
+}
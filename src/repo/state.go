@@ -0,0 +1,168 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StateFiles are the files in the git directory whose presence marks an operation in progress
+// The watcher observes them so the state banner updates live
+var StateFiles = []string{"MERGE_HEAD", "CHERRY_PICK_HEAD", "REVERT_HEAD", "BISECT_LOG", "rebase-merge", "rebase-apply"}
+
+// State describes an operation in progress in the repository and where HEAD points
+type State struct {
+	Operation string // "rebasing", "applying", "merging", "cherry-picking", "reverting", "bisecting", or "" when idle
+	Step      int    // Current step of a rebase or git am, 0 when unknown
+	Total     int    // Number of steps of a rebase or git am
+	Branch    string // Branch being rebased, or the branch being merged
+	Target    string // Short hash the rebase replays onto, or of the commit being merged, picked or reverted
+	Good      int    // Commits marked good during a bisect
+	Bad       int    // Commits marked bad during a bisect
+	Detached  string // Short hash of HEAD when it's detached from any branch
+}
+
+// mergeMessage finds the merged branch in the message git prepares for a merge commit
+var mergeMessage = regexp.MustCompile(`^Merge (?:remote-tracking )?(?:branch|tag|commit) '([^']+)'`)
+
+// State reads the operation in progress from the git directory, without running git
+func (c *Context) State() State {
+	var state State
+
+	head := c.readFile("HEAD")
+	if head != "" && !strings.HasPrefix(head, "ref: ") {
+		state.Detached = shortHash(head)
+	}
+
+	switch {
+	case c.exists("rebase-merge"):
+		state.Operation = "rebasing"
+		state.Step, _ = strconv.Atoi(c.readFile("rebase-merge/msgnum"))
+		state.Total, _ = strconv.Atoi(c.readFile("rebase-merge/end"))
+		state.Branch = c.rebasedBranch("rebase-merge")
+		state.Target = shortHash(c.readFile("rebase-merge/onto"))
+	case c.exists("rebase-apply"):
+		// rebase-apply is shared by the apply backend of git rebase and by git am
+		state.Operation = "rebasing"
+		if c.exists("rebase-apply/applying") {
+			state.Operation = "applying"
+		}
+		state.Step, _ = strconv.Atoi(c.readFile("rebase-apply/next"))
+		state.Total, _ = strconv.Atoi(c.readFile("rebase-apply/last"))
+		state.Branch = c.rebasedBranch("rebase-apply")
+		state.Target = shortHash(c.readFile("rebase-apply/onto"))
+	case c.exists("MERGE_HEAD"):
+		state.Operation = "merging"
+		state.Target = shortHash(c.readFile("MERGE_HEAD"))
+		if match := mergeMessage.FindStringSubmatch(c.readFile("MERGE_MSG")); match != nil {
+			state.Branch = match[1]
+		}
+	case c.exists("CHERRY_PICK_HEAD"):
+		state.Operation = "cherry-picking"
+		state.Target = shortHash(c.readFile("CHERRY_PICK_HEAD"))
+	case c.exists("REVERT_HEAD"):
+		state.Operation = "reverting"
+		state.Target = shortHash(c.readFile("REVERT_HEAD"))
+	case c.exists("BISECT_LOG"):
+		state.Operation = "bisecting"
+		state.Good, state.Bad = c.bisectCounts()
+	}
+
+	return state
+}
+
+// Describe returns a one-line summary such as "rebasing feature 3/7 onto abc1234",
+// or "" when no operation is in progress and HEAD is on a branch
+func (s State) Describe() string {
+	var parts []string
+
+	switch s.Operation {
+	case "rebasing", "applying":
+		text := s.Operation
+		if s.Operation == "applying" {
+			text = "applying patches"
+		} else if s.Branch != "" {
+			text += " " + s.Branch
+		}
+		if s.Total > 0 {
+			text += fmt.Sprintf(" %d/%d", s.Step, s.Total)
+		}
+		if s.Target != "" {
+			text += " onto " + s.Target
+		}
+		// HEAD is always detached while commits are replayed
+		return text
+	case "merging":
+		if s.Branch != "" {
+			parts = append(parts, fmt.Sprintf("merging %s (%s)", s.Branch, s.Target))
+		} else {
+			parts = append(parts, "merging "+s.Target)
+		}
+	case "cherry-picking", "reverting":
+		parts = append(parts, s.Operation+" "+s.Target)
+	case "bisecting":
+		parts = append(parts, fmt.Sprintf("bisecting (%d good, %d bad)", s.Good, s.Bad))
+	}
+
+	if s.Detached != "" {
+		parts = append(parts, "HEAD detached at "+s.Detached)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rebasedBranch returns the branch a rebase started from, or "" when it started from a detached HEAD
+func (c *Context) rebasedBranch(dir string) string {
+	name := c.readFile(dir + "/head-name")
+	if !strings.HasPrefix(name, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(name, "refs/heads/")
+}
+
+// bisectCounts counts the commits marked good and bad in BISECT_LOG
+// Custom terms from "git bisect start --term-old/--term-new" are read from BISECT_TERMS
+func (c *Context) bisectCounts() (good, bad int) {
+	badTerm, goodTerm := "bad", "good"
+	if terms := strings.Split(c.readFile("BISECT_TERMS"), "\n"); len(terms) == 2 {
+		badTerm, goodTerm = terms[0], terms[1]
+	}
+
+	for _, line := range strings.Split(c.readFile("BISECT_LOG"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "git" || fields[1] != "bisect" {
+			continue
+		}
+		switch fields[2] {
+		case goodTerm:
+			good++
+		case badTerm:
+			bad++
+		}
+	}
+	return good, bad
+}
+
+// readFile returns the trimmed contents of a file in the per-worktree git directory, or "" if it's missing
+func (c *Context) readFile(name string) string {
+	data, err := os.ReadFile(c.GitPath(name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// exists returns true if a file or directory exists in the per-worktree git directory
+func (c *Context) exists(name string) bool {
+	_, err := os.Stat(c.GitPath(name))
+	return err == nil
+}
+
+// shortHash abbreviates a commit hash to the length git usually shows
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
@@ -23,8 +23,36 @@ var (
 	ActiveTabStyle   = lipgloss.NewStyle().Background(lipgloss.Color("12")).Foreground(lipgloss.Color("15")).Bold(true).Padding(0, 2)
 	InactiveTabStyle = lipgloss.NewStyle().Background(lipgloss.Color("236")).Foreground(lipgloss.Color("7")).Padding(0, 2)
 	TabGapStyle      = lipgloss.NewStyle().Background(lipgloss.Color("234"))
+	CommitHashStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	RangeLabelStyle  = lipgloss.NewStyle().Background(lipgloss.Color("#6B5B7C")).Foreground(lipgloss.Color("15")).Bold(true).Padding(0, 2)
+	StateBannerStyle = lipgloss.NewStyle().Background(lipgloss.Color("#8C6A2E")).Foreground(lipgloss.Color("15")).Bold(true) // Amber for merges, rebases, ...
 	ResetCode        = "\x1b[0m"
 
+	// Hunk selection colors
+	SelectedHunkStyle = lipgloss.NewStyle().Background(lipgloss.Color("#264F78")).Foreground(lipgloss.Color("15")).Bold(true) // Header of the selected hunk
+	HunkCursorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#4F8FD8"))                                             // Gutter mark beside the selected hunk's lines
+	VisualGutterStyle = lipgloss.NewStyle().Background(lipgloss.Color("#6B5B7C")).Foreground(lipgloss.Color("15"))            // Line numbers of rows in a visual selection
+
+	// Stats view colors
+	StatsPickedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Bold(true) // Check mark of files picked for a batch action
+
+	// Commit composer colors
+	ComposerOnStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Bold(true) // Options turned on, a commit that succeeded
+	ComposerWarnStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Bold(true) // Subject longer than the usual 50 characters
+	ComposerFailStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true)  // Subject past 72 characters, a failed commit
+
+	// Trash browser colors
+	TrashSelectedStyle = lipgloss.NewStyle().Background(lipgloss.Color("#264F78")).Foreground(lipgloss.Color("15")).Bold(true) // Selected discard
+
+	// Conflict view colors
+	ConflictSideStyle   = lipgloss.NewStyle().Background(lipgloss.Color("236")).Foreground(lipgloss.Color("7")).Bold(true)      // Header of an unchosen side
+	ConflictChosenStyle = lipgloss.NewStyle().Background(lipgloss.Color("#2e6b2e")).Foreground(lipgloss.Color("15")).Bold(true) // Chosen side and selected conflict
+	ConflictMarkerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true)                                        // Unresolved conflict markers
+
+	// Submodule commit log colors
+	SubmoduleAddedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("10")) // Commits only in the new submodule commit
+	SubmoduleRemovedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))  // Commits only in the old submodule commit
+
 	// Table styles shared across views
 	TableBorder = table.Border{
 		Top:            "─",
@@ -1,31 +1,98 @@
 package utils
 
-import "strings"
+import (
+	"strings"
 
-// Truncate truncates a string to maxLen characters
-func Truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
+	"github.com/rivo/uniseg"
+)
+
+// TabWidth is the number of columns between tab stops when tabs are expanded for display
+var TabWidth = 4
+
+// forEachCell walks an ANSI-styled string, passing escape sequences to onEscape and each visible
+// grapheme cluster to onCell with the column it starts at and its display width in terminal cells
+// Tabs are reported as runs of spaces reaching the next tab stop
+func forEachCell(s string, onEscape func(seq string), onCell func(cluster string, col, width int)) {
+	col := 0
+	for len(s) > 0 {
+		if s[0] == '\x1b' {
+			// Escape sequences end at the first letter
+			end := 1
+			for end < len(s) && !((s[end] >= 'a' && s[end] <= 'z') || (s[end] >= 'A' && s[end] <= 'Z')) {
+				end++
+			}
+			end = min(end+1, len(s))
+			if onEscape != nil {
+				onEscape(s[:end])
+			}
+			s = s[end:]
+			continue
+		}
+
+		if s[0] == '\t' {
+			width := TabWidth - col%max(TabWidth, 1)
+			onCell(strings.Repeat(" ", width), col, width)
+			col += width
+			s = s[1:]
+			continue
+		}
+
+		// Stop the cluster at the next escape or tab so they're handled above
+		next := strings.IndexAny(s, "\x1b\t")
+		if next == -1 {
+			next = len(s)
+		}
+		cluster, _, width, _ := uniseg.FirstGraphemeClusterInString(s[:next], -1)
+		onCell(cluster, col, width)
+		col += width
+		s = s[len(cluster):]
+	}
+}
+
+// Width returns the number of terminal cells a string occupies, ignoring ANSI codes
+// Wide characters (CJK, emoji) count as two cells, combining marks as none, and tabs expand to the next stop
+func Width(s string) int {
+	total := 0
+	forEachCell(s, nil, func(_ string, _, width int) {
+		total += width
+	})
+	return total
+}
+
+// ExpandTabs replaces tabs with spaces up to the next tab stop, keeping ANSI codes
+func ExpandTabs(s string) string {
+	if !strings.Contains(s, "\t") {
 		return s
 	}
-	if maxLen <= 3 {
-		return s[:maxLen]
+	return SliceAnsi(s, 0, Width(s))
+}
+
+// Truncate shortens a string to at most maxWidth cells, ending it with "..." when cut
+// Never splits a character; tabs are expanded
+func Truncate(s string, maxWidth int) string {
+	if Width(s) <= maxWidth {
+		return ExpandTabs(s)
+	}
+	if maxWidth <= 3 {
+		return SliceAnsi(s, 0, maxWidth)
 	}
-	return s[:maxLen-3] + "..."
+	return SliceAnsi(s, 0, maxWidth-3) + "..."
 }
 
-// PadRight pads a string with spaces to reach the desired length
-func PadRight(s string, length int) string {
-	// Strip ANSI codes for length calculation
-	visibleLen := len(StripAnsi(s))
-	if visibleLen >= length {
+// PadRight pads a string with spaces to reach the desired width in cells
+func PadRight(s string, width int) string {
+	// Strip ANSI codes for width calculation
+	s = ExpandTabs(s)
+	visibleWidth := Width(s)
+	if visibleWidth >= width {
 		return s
 	}
-	return s + strings.Repeat(" ", length-visibleLen)
+	return s + strings.Repeat(" ", width-visibleWidth)
 }
 
 // StripAnsi removes ANSI escape codes from a string for length calculation
 func StripAnsi(s string) string {
-	result := ""
+	var result strings.Builder
 	inEscape := false
 	for _, r := range s {
 		if r == '\x1b' {
@@ -38,7 +105,42 @@ func StripAnsi(s string) string {
 			}
 			continue
 		}
-		result += string(r)
+		result.WriteRune(r)
 	}
-	return result
+	return result.String()
+}
+
+// WrapStarts returns the column each row of s starts at when it is soft-wrapped into rows of width cells
+// Rows break before a character that would cross the edge, so wide characters move to the next row whole
+// instead of being cut; a character wider than a whole row gets a row of its own
+func WrapStarts(s string, width int) []int {
+	starts := []int{0}
+	if width <= 0 {
+		return starts
+	}
+	forEachCell(s, nil, func(_ string, col, cellWidth int) {
+		start := starts[len(starts)-1]
+		if col > start && col+cellWidth > start+width {
+			starts = append(starts, col)
+		}
+	})
+	return starts
+}
+
+// SliceAnsi returns the cells of an ANSI-styled string from column start up to end
+// Every escape sequence is kept, so colors set before start still apply to the slice.
+// A wide character or tab cut by either edge is replaced by spaces for its visible part
+func SliceAnsi(s string, start, end int) string {
+	var result strings.Builder
+	forEachCell(s, func(seq string) {
+		result.WriteString(seq)
+	}, func(cluster string, col, width int) {
+		switch {
+		case col >= start && col+width <= end:
+			result.WriteString(cluster)
+		case col < end && col+width > start:
+			result.WriteString(strings.Repeat(" ", min(col+width, end)-max(col, start)))
+		}
+	})
+	return result.String()
 }
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWrapStarts(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []int
+		parts []string // Each row cut with SliceAnsi between its start and the next
+	}{
+		{"abcdefgh", 5, []int{0, 5}, []string{"abcde", "fgh"}},
+		{"abcde", 5, []int{0}, []string{"abcde"}},
+		{"", 5, []int{0}, []string{""}},
+		// The wide character doesn't fit in the first row's last cell, so the row ends early
+		{"abcd中ef", 5, []int{0, 4}, []string{"abcd", "中ef"}},
+		{"中中中", 3, []int{0, 2, 4}, []string{"中", "中", "中"}},
+		// A character wider than the row still gets a row of its own
+		{"a中b", 1, []int{0, 1, 3}, []string{"a", " ", "b"}},
+		{"ab\tc", 3, []int{0, 2}, []string{"ab", "  c"}},
+	}
+
+	for _, tt := range tests {
+		starts := WrapStarts(tt.text, tt.width)
+		if !slices.Equal(starts, tt.want) {
+			t.Errorf("WrapStarts(%q, %d) = %v, want %v", tt.text, tt.width, starts, tt.want)
+			continue
+		}
+		var parts []string
+		for i, start := range starts {
+			end := start + tt.width
+			if i+1 < len(starts) {
+				end = min(end, starts[i+1])
+			}
+			parts = append(parts, SliceAnsi(tt.text, start, end))
+		}
+		if !slices.Equal(parts, tt.parts) {
+			t.Errorf("rows of %q at width %d = %q, want %q", tt.text, tt.width, parts, tt.parts)
+		}
+	}
+}
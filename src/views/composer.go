@@ -0,0 +1,128 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"gg/src/models"
+	"gg/src/styles"
+	"gg/src/utils"
+)
+
+// Subject lengths the composer's guide warns at: the usual target, and the point where tools start cutting it off
+const (
+	subjectTarget = 50
+	subjectLimit  = 72
+)
+
+// RenderComposerView renders the commit screen: options, message editor, subject guide, staged files and commit output
+func RenderComposerView(m *models.Model) string {
+	c := &m.Composer
+	_, stagedHeight, outputHeight := m.ComposerHeights()
+	var rows []string
+
+	// Title with the option toggles
+	toggles := []string{
+		composerToggle("amend", c.Options.Amend),
+		composerToggle("sign-off", c.Options.SignOff),
+		composerToggle("no-verify", c.Options.NoVerify),
+	}
+	title := styles.HeaderStyle.Render(" Commit") + "   " + strings.Join(toggles, "  ")
+	rows = append(rows, utils.Truncate(title, m.Width))
+
+	rows = append(rows, strings.Split(c.Editor.View(), "\n")...)
+	rows = append(rows, renderSubjectGuide(c))
+
+	// Everything staged, including files outside the pathspecs
+	rows = append(rows, renderStagedFiles(m, stagedHeight)...)
+
+	// Output of the last commit, hooks included
+	header := " git commit output"
+	switch c.Result {
+	case "ok":
+		header = styles.ComposerOnStyle.Render(header + " - committed")
+	case "failed":
+		header = styles.ComposerFailStyle.Render(header + " - failed")
+	default:
+		header = styles.HeaderStyle.Render(header)
+	}
+	if c.Focus == "output" {
+		header += styles.LineNumStyle.Render(" (scrolling)")
+	}
+	rows = append(rows, utils.Truncate(header, m.Width))
+	output := strings.Split(c.Output.View(), "\n")
+	for i := 0; i < outputHeight; i++ {
+		line := ""
+		if i < len(output) {
+			line = utils.Truncate(output[i], m.Width)
+		}
+		rows = append(rows, line)
+	}
+
+	leftHelp := "ctrl+s:commit alt+a:amend alt+s:sign-off alt+n:no-verify tab:output esc:close"
+	if c.Focus == "output" {
+		leftHelp = "↑↓:scroll ctrl+s:commit tab:message esc:close"
+	}
+	help := RenderHelpBarSplit(leftHelp, "^c:quit", m.Width)
+	return strings.Join(rows, "\n") + "\n" + renderStateBanner(m) + help
+}
+
+// composerToggle renders a commit option as a checkbox
+func composerToggle(label string, on bool) string {
+	if on {
+		return styles.ComposerOnStyle.Render("[x] " + label)
+	}
+	return styles.LineNumStyle.Render("[ ] " + label)
+}
+
+// renderSubjectGuide counts the subject's length against the usual 50 and 72 character limits,
+// and reminds that the body goes after a blank line
+func renderSubjectGuide(c *models.Composer) string {
+	length := utils.Width(c.Subject())
+	style := styles.LineNumStyle
+	if length > subjectLimit {
+		style = styles.ComposerFailStyle
+	} else if length > subjectTarget {
+		style = styles.ComposerWarnStyle
+	}
+	guide := style.Render(fmt.Sprintf(" subject %d/%d", length, subjectTarget))
+
+	lines := strings.Split(c.Editor.Value(), "\n")
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		guide += styles.ComposerWarnStyle.Render(" · leave the second line blank")
+	}
+	return guide
+}
+
+// renderStagedFiles lists the staged files under a summary line, in height rows
+func renderStagedFiles(m *models.Model, height int) []string {
+	files := m.Composer.Staged
+	additions, deletions := 0, 0
+	for _, file := range files {
+		additions += file.Additions
+		deletions += file.Deletions
+	}
+
+	summary := fmt.Sprintf(" Staged: %d files, +%d -%d", len(files), additions, deletions)
+	if len(files) == 0 {
+		summary = " Nothing staged"
+		if m.Composer.Options.Amend {
+			summary += ", amending changes the message only"
+		}
+	}
+	rows := []string{styles.HeaderStyle.Render(summary)}
+
+	for i, file := range files {
+		if i == height-1 && len(files) > height {
+			rows = append(rows, styles.LineNumStyle.Render(fmt.Sprintf("   ... %d more", len(files)-i)))
+			break
+		}
+		status := getStatusStyle(file.Status).Render(file.Status[:1])
+		counts := styles.LineNumStyle.Render(fmt.Sprintf("  +%d -%d", file.Additions, file.Deletions))
+		rows = append(rows, utils.Truncate("   "+status+" "+utils.ExpandTabs(file.Path)+counts, m.Width))
+	}
+	for len(rows) < height+1 {
+		rows = append(rows, "")
+	}
+	return rows
+}
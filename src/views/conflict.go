@@ -0,0 +1,151 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"gg/src/models"
+	"gg/src/styles"
+	"gg/src/utils"
+)
+
+// Backgrounds telling apart the sides of a conflict in the merged result
+var conflictBackgrounds = map[string]string{
+	"ours":   "\x1b[48;2;30;45;77m", // #1e2d4d
+	"base":   "\x1b[48;2;45;45;45m", // #2d2d2d
+	"theirs": "\x1b[48;2;61;30;77m", // #3d1e4d
+}
+
+// conflictPaneHeights splits the diff area between the sides of the active conflict and the merged result
+// Both heights include the pane's header line
+func conflictPaneHeights(m *models.Model) (int, int) {
+	height := m.LeftViewport.Height
+	sides := max(height*2/5, 3)
+	return sides, max(height-sides, 2)
+}
+
+// updateConflictContent prepares the conflict view of an unmerged file
+// The viewport scrolls the merged result, which starts below the sides of the active conflict
+func updateConflictContent(m *models.Model, file *models.FileDiff, conflict *models.Conflict) {
+	// Start at the selected conflict when switching to the file, but not when the same file is reloaded
+	key := models.LayoutKey{File: file, Set: m.DiffType, Path: file.Name}
+	if old := m.DiffLayout; old == nil || old.Key.Set != key.Set || old.Key.Path != key.Path || len(old.Rows) > 0 {
+		m.LeftViewport.YOffset = max(conflict.Start(conflict.Active)-2, 0)
+	}
+	m.DiffLayout = &models.DiffLayout{Key: key}
+
+	// Pad the placeholder so the last result line can scroll into the result pane
+	_, resultHeight := conflictPaneHeights(m)
+	lines := len(conflict.ResultLines()) + m.LeftViewport.Height - (resultHeight - 1)
+	m.LeftViewport.SetContent(strings.Repeat("\n", max(lines-1, 0)))
+	m.RightViewport.YOffset = m.LeftViewport.YOffset
+}
+
+// renderConflictView renders the active conflict's ours, base and theirs sides above the merged result
+func renderConflictView(m *models.Model, file *models.FileDiff, conflict *models.Conflict) string {
+	sidesHeight, resultHeight := conflictPaneHeights(m)
+	var rows []string
+
+	// Sides of the selected conflict in three columns; chosen sides get a highlighted header
+	region := conflict.Region(conflict.Active)
+	colWidth := (m.Width - 2) / 3
+	lastWidth := m.Width - 2 - 2*colWidth
+	divider := styles.DividerStyle.Render("│")
+
+	type column struct {
+		side   string
+		title  string
+		lines  []string
+		width  int
+		chosen bool
+	}
+	var columns []column
+	if region != nil {
+		columns = []column{
+			{"ours", "ours (HEAD)", region.Ours, colWidth, region.Choice == "ours" || region.Choice == "both"},
+			{"base", "base", region.Base, colWidth, false},
+			{"theirs", "theirs", region.Theirs, lastWidth, region.Choice == "theirs" || region.Choice == "both"},
+		}
+		if !conflict.HasBase {
+			columns[1].title = "base (no common ancestor)"
+		}
+	}
+
+	if len(columns) == 0 {
+		rows = append(rows, styles.HeaderStyle.Render(utils.PadRight(" no conflicts left", m.Width)))
+		for len(rows) < sidesHeight {
+			rows = append(rows, "")
+		}
+	} else {
+		var header []string
+		for _, col := range columns {
+			style := styles.ConflictSideStyle
+			if col.chosen {
+				style = styles.ConflictChosenStyle
+			}
+			header = append(header, style.Render(utils.PadRight(utils.Truncate(" "+col.title, col.width), col.width)))
+		}
+		rows = append(rows, strings.Join(header, divider))
+
+		for i := 0; i < sidesHeight-1; i++ {
+			var cells []string
+			for _, col := range columns {
+				text := ""
+				switch {
+				case i == sidesHeight-2 && len(col.lines) > sidesHeight-1:
+					// Not enough room: say how much is hidden
+					text = styles.LineNumStyle.Render(fmt.Sprintf(" ... %d more lines", len(col.lines)-i))
+				case i < len(col.lines):
+					text = formatConflictCode(m, file, col.lines[i], conflictBackgrounds[col.side], col.width)
+				}
+				cells = append(cells, utils.PadRight(text, col.width))
+			}
+			rows = append(rows, strings.Join(cells, divider))
+		}
+	}
+
+	// The merged result as it would be written, unresolved conflicts still marked
+	status := "all conflicts resolved, R to write and stage"
+	if n := conflict.Unresolved(); n > 0 {
+		status = fmt.Sprintf("%d of %d conflicts unresolved", n, conflict.Count())
+	}
+	rows = append(rows, styles.HeaderStyle.Render(utils.PadRight(utils.Truncate(" result - "+status, m.Width), m.Width)))
+
+	lines := conflict.ResultLines()
+	codeWidth := m.Width - 6 // -6 for line numbers ("12345 ")
+	for i := m.LeftViewport.YOffset; i < m.LeftViewport.YOffset+resultHeight-1; i++ {
+		if i >= len(lines) {
+			rows = append(rows, "")
+			continue
+		}
+		line := lines[i]
+
+		// Mark the selected conflict in the gutter
+		gutter := styles.LineNumStyle
+		if line.Conflict >= 0 && line.Conflict == conflict.Active {
+			gutter = styles.ConflictChosenStyle
+		}
+		number := gutter.Render(fmt.Sprintf("%5d ", i+1))
+
+		if line.Side == "marker" {
+			rows = append(rows, number+styles.ConflictMarkerStyle.Render(utils.PadRight(line.Text, codeWidth)))
+			continue
+		}
+		rows = append(rows, number+formatConflictCode(m, file, line.Text, conflictBackgrounds[line.Side], codeWidth))
+	}
+
+	return strings.Join(rows, "\n")
+}
+
+// formatConflictCode renders a line with syntax highlighting on the given background, cut to the
+// horizontal scroll window and padded to width
+func formatConflictCode(m *models.Model, file *models.FileDiff, text string, bg string, width int) string {
+	highlighted := file.HighlightLine(text)
+	if bg == "" {
+		return styles.NeutralStyle.Render(utils.PadRight(utils.SliceAnsi(highlighted, m.ScrollX, m.ScrollX+width), width))
+	}
+
+	highlighted = applyBackground(highlighted, bg, bg, nil)
+	visible := utils.SliceAnsi(highlighted, m.ScrollX, m.ScrollX+width)
+	return visible + bg + strings.Repeat(" ", max(width-utils.Width(visible), 0)) + "\x1b[49m"
+}
@@ -1,7 +1,9 @@
 package views
 
 import (
+	"cmp"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"gg/src/models"
@@ -11,17 +13,22 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
-// getAutoReloadStatus returns "on" if enabled, "off" otherwise
-func getAutoReloadStatus(enabled bool) string {
-	if enabled {
-		return "on"
+// getAutoReloadStatus returns "on" with the watcher backend if enabled, "off" otherwise
+// Without a watcher, changes can't be detected at all
+func getAutoReloadStatus(m *models.Model) string {
+	switch {
+	case m.WatchBackend == "":
+		return "unavailable"
+	case m.AutoReloadEnabled:
+		return "on," + m.WatchBackend
+	default:
+		return "off"
 	}
-	return "off"
 }
 
 // highlightSearchMatches highlights search query matches in text
-// Returns the highlighted text and match positions
-func highlightSearchMatches(text string, query string, lineIdx int) (string, []models.SearchMatch) {
+// Returns the highlighted text and match columns
+func highlightSearchMatches(text string, query string) (string, []models.SearchMatch) {
 	if query == "" {
 		return text, nil
 	}
@@ -38,7 +45,7 @@ func highlightSearchMatches(text string, query string, lineIdx int) (string, []m
 			break
 		}
 		actualIdx := searchStart + idx
-		matches = append(matches, models.SearchMatch{LineIdx: lineIdx, Col: actualIdx})
+		matches = append(matches, models.SearchMatch{Col: actualIdx})
 		searchStart = actualIdx + len(query)
 	}
 
@@ -78,327 +85,398 @@ func highlightSearchMatches(text string, query string, lineIdx int) (string, []m
 	return result.String(), matches
 }
 
-// getDiffTypeIndicator returns a string indicator for the diff type
-func getDiffTypeIndicator(diffType string) string {
-	if diffType == "staged" {
-		return " (staged)"
-	}
-	return ""
-}
-
-// UpdateContent updates the viewport content with the current file's diff
-func UpdateContent(m *models.Model) {
-	if len(m.Files) == 0 || m.ActiveTab >= len(m.Files) {
-		return
-	}
-
-	currentFile := m.Files[m.ActiveTab]
-	content := currentFile.Content
-
-	// Reset search matches for this update
-	m.DiffSearch.Matches = nil
-
-	// For untracked files, show file content on right side (like additions)
-	if currentFile.Status == "Untracked" {
-		leftColWidth := m.LeftViewport.Width
-		rightColWidth := m.RightViewport.Width
-		rightContentWidth := rightColWidth - 6 // -6 for line numbers
-
-		var rightLines []string
-		rightLineNum := 1
-
-		for lineIdx, line := range content {
-			// Apply syntax highlighting
-			highlighted := line
-			highlighted = currentFile.HighlightLine(lineIdx, line)
-
-			// Truncate if needed
-			visibleLen := len(utils.StripAnsi(highlighted))
-			if visibleLen > rightContentWidth {
-				// Truncate the original line safely
-				maxLen := min(len(line), rightContentWidth-3)
-				if maxLen < 0 {
-					maxLen = 0
-				}
-				line = line[:maxLen] + "..."
-				highlighted = line
-				highlighted = currentFile.HighlightLine(lineIdx, line)
+// applyBackground sets a background color under ANSI-highlighted text, using strongBg for the given spans
+// Spans are byte offsets into the visible text. The background is restored after every reset that
+// chroma emits between tokens, and left alone inside sequences that set their own background (search matches)
+func applyBackground(text string, bg string, strongBg string, spans []models.Span) string {
+	var result strings.Builder
+	current := ""
+	foreign := false
+	pos := 0
+	spanIdx := 0
+
+	for i := 0; i < len(text); {
+		// Copy escape sequences through, noting resets and foreign backgrounds
+		if text[i] == '\x1b' {
+			end := i + 1
+			for end < len(text) && !((text[end] >= 'a' && text[end] <= 'z') || (text[end] >= 'A' && text[end] <= 'Z')) {
+				end++
 			}
-
-			// Apply background color for additions
-			bgCode := "\x1b[48;2;30;61;30m" // #1e3d1e
-			resetBg := "\x1b[49m"
-
-			padding := rightContentWidth - len(utils.StripAnsi(highlighted))
-			if padding < 0 {
-				padding = 0
+			end = min(end+1, len(text))
+			seq := text[i:end]
+			result.WriteString(seq)
+
+			switch {
+			case seq == "\x1b[0m" || seq == "\x1b[m" || seq == "\x1b[49m":
+				foreign = false
+				current = ""
+			case strings.HasPrefix(seq, "\x1b[48;"):
+				foreign = true
 			}
+			i = end
+			continue
+		}
 
-			lineNum := fmt.Sprintf("%5d ", rightLineNum)
-			left := "      " + styles.NeutralStyle.Render(strings.Repeat(" ", leftColWidth))
-			right := styles.LineNumBgRight.Render(lineNum) + bgCode + highlighted + strings.Repeat(" ", padding) + resetBg
-
-			rightLines = append(rightLines, left+styles.DividerStyle.Render("│")+right)
-			rightLineNum++
+		// Pick the background for this byte of visible text
+		for spanIdx < len(spans) && spans[spanIdx].End <= pos {
+			spanIdx++
+		}
+		want := bg
+		if spanIdx < len(spans) && spans[spanIdx].Start <= pos {
+			want = strongBg
+		}
+		if !foreign && want != current {
+			result.WriteString(want)
+			current = want
 		}
 
-		m.LeftViewport.SetContent("")
-		m.RightViewport.SetContent(strings.Join(rightLines, "\n"))
-		return
+		result.WriteByte(text[i])
+		pos++
+		i++
 	}
 
-	// Use the actual viewport widths (set in model.go)
-	leftColWidth := m.LeftViewport.Width
-	rightColWidth := m.RightViewport.Width
-	leftContentWidth := leftColWidth - 6   // -6 for line numbers ("12345 ")
-	rightContentWidth := rightColWidth - 6 // -6 for line numbers ("12345 ")
-
-	// Calculate full width for headers (full screen width minus center divider)
-	fullWidth := m.Width - 1
-
-	var leftLines, rightLines []string
-	leftLineNum := 0
-	rightLineNum := 0
-
-	// Collect search matches if there's a search query
-	searchQuery := m.DiffSearch.Query
-
-	for lineIdx, line := range content {
-		// Check for search matches in this line (before stripping +/-)
-		lineContent := line
-		if len(line) > 0 && (line[0] == '+' || line[0] == '-') && !strings.HasPrefix(line, "+++") && !strings.HasPrefix(line, "---") {
-			lineContent = line[1:]
-		}
-		if searchQuery != "" && strings.Contains(strings.ToLower(lineContent), strings.ToLower(searchQuery)) {
-			m.DiffSearch.Matches = append(m.DiffSearch.Matches, models.SearchMatch{LineIdx: lineIdx, Col: 0})
-		}
+	if !foreign && current != bg {
+		result.WriteString(bg)
+	}
+	return result.String()
+}
 
-		left, right, isFullWidth, skip := formatLineWithWidths(m, line, leftContentWidth, rightContentWidth, fullWidth, lineIdx, &leftLineNum, &rightLineNum, searchQuery)
-		if skip {
-			// Skip this line entirely
+// buildRightHelp builds the right side of the help bar from the given view switching keys
+// It adds the auto-reload toggle and diff indicators, and drops keys unavailable without a repository
+func buildRightHelp(m *models.Model, keys ...string) string {
+	var items []string
+	if m.Loading {
+		items = append(items, "loading...")
+	}
+	if m.HasRepository() {
+		items = append(items, fmt.Sprintf("a:auto-reload[%s]", getAutoReloadStatus(m)))
+		items = append(items, "c:commit")
+	}
+	for _, key := range keys {
+		if key == "l:log" && !m.HasRepository() {
 			continue
 		}
-		if isFullWidth {
-			// Header lines that span full width
-			leftLines = append(leftLines, left)
-			rightLines = append(rightLines, "")
-		} else {
-			leftLines = append(leftLines, left)
-			rightLines = append(rightLines, right)
-		}
+		items = append(items, key)
 	}
+	return strings.Join(items, " ") + getDiffTypeIndicator(m) + getScopeIndicator(m) + " q:quit"
+}
 
-	m.LeftViewport.SetContent(strings.Join(leftLines, "\n"))
-	m.RightViewport.SetContent(strings.Join(rightLines, "\n"))
+// getStageIndicator returns the help bar item for staging or unstaging the selected hunk, if the diff allows it
+func getStageIndicator(m *models.Model) string {
+	if action := m.StageAction(); action != "" {
+		return "S:" + action + " V:lines "
+	}
+	return ""
 }
 
-// formatLineWithWidths formats a single diff line for display with separate left/right widths
-func formatLineWithWidths(m *models.Model, line string, leftWidth int, rightWidth int, fullWidth int, lineIdx int, leftLineNum, rightLineNum *int, searchQuery string) (string, string, bool, bool) {
-	if len(line) == 0 {
-		return "", "", false, false
+// getIntraLineIndicator returns a help bar item showing whether changed words or characters are emphasized
+func getIntraLineIndicator(m *models.Model) string {
+	if m.IntraLineMode == "char" {
+		return "i:inline[char]"
 	}
+	return "i:inline[word]"
+}
 
-	// Skip diff --git, ---, +++ lines (filename info redundant with tabs)
-	if strings.HasPrefix(line, "diff --git") ||
-		strings.HasPrefix(line, "---") ||
-		strings.HasPrefix(line, "+++") {
-		return "", "", false, true // skip = true
+// getWrapIndicator returns help bar items for soft-wrap and, when not wrapping, the horizontal scroll column
+func getWrapIndicator(m *models.Model) string {
+	if m.WrapLines {
+		return "w:wrap[on]"
+	}
+	if m.ScrollX > 0 {
+		return fmt.Sprintf("</>:pan[+%d] w:wrap[off]", m.ScrollX)
 	}
+	return "</>:pan w:wrap[off]"
+}
 
-	// Skip index line - not useful to users
-	if strings.HasPrefix(line, "index ") {
-		return "", "", false, true // skip = true
+// getLayoutIndicator returns a help bar item showing whether the diff is split or unified
+func getLayoutIndicator(m *models.Model) string {
+	layout := "split"
+	if m.IsUnified() {
+		layout = "unified"
+	}
+	if m.Layout == "" {
+		layout += ",auto"
 	}
+	return fmt.Sprintf("v:layout[%s]", layout)
+}
 
-	if strings.HasPrefix(line, "@@") {
-		// Extract line numbers from @@ header
-		parts := strings.Split(line, "@@")
-		if len(parts) >= 2 {
-			nums := strings.TrimSpace(parts[1])
-			// Parse "-leftStart,leftCount +rightStart,rightCount"
-			if strings.Contains(nums, "-") && strings.Contains(nums, "+") {
-				leftPart := strings.Split(strings.Split(nums, "+")[0], "-")[1]
-				rightPart := strings.Split(nums, "+")[1]
+// patchLabel returns a short name for a patch source
+func patchLabel(source string) string {
+	if source == "-" {
+		return "stdin"
+	}
+	return filepath.Base(source)
+}
 
-				if leftNum := strings.Split(strings.TrimSpace(leftPart), ","); len(leftNum) > 0 {
-					fmt.Sscanf(leftNum[0], "%d", leftLineNum)
-				}
-				if rightNum := strings.Split(strings.TrimSpace(rightPart), ","); len(rightNum) > 0 {
-					fmt.Sscanf(rightNum[0], "%d", rightLineNum)
-				}
-			}
-		}
+// getScopeIndicator returns a help bar item listing the pathspecs the session is limited to
+func getScopeIndicator(m *models.Model) string {
+	if len(m.Pathspecs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" scope[%s]", strings.Join(m.Pathspecs, ","))
+}
 
-		// Just show the hunk header
-		formatted := styles.HeaderStyle.Render(utils.PadRight(utils.Truncate(line, fullWidth), fullWidth))
-		return formatted, "", true, false
+// getDiffTypeIndicator returns a help bar item showing the active diff type and how to switch it
+// When a revision range is being shown, the resolved range is displayed instead
+func getDiffTypeIndicator(m *models.Model) string {
+	if m.PatchSource != "" {
+		return fmt.Sprintf(" patch[%s]", patchLabel(m.PatchSource))
+	}
+	if m.NoIndex != "" {
+		return fmt.Sprintf(" compare[%s]", m.NoIndex)
+	}
+	if m.Range != "" {
+		return fmt.Sprintf(" range[%s]", m.Range)
+	}
+	if m.DiffType == "" || m.DiffType == "none" {
+		return ""
 	}
+	return fmt.Sprintf(" t:changes[%s]", m.DiffType)
+}
 
-	// Get current file reference for syntax highlighting
-	var fileRef *models.FileDiff
-	if m.ActiveTab < len(m.Files) {
-		fileRef = &m.Files[m.ActiveTab]
+// formatFileSummary describes a file change that has no hunks to show
+func formatFileSummary(header models.FileHeader, fullWidth int) []string {
+	render := func(text string) string {
+		return styles.NeutralStyle.Render(utils.PadRight(utils.Truncate(text, fullWidth), fullWidth))
 	}
 
-	// Handle diff lines
-	if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---") {
-		// Removed line - show on left only with syntax highlighting
-		text := line[1:]
+	var lines []string
+	if header.IsRename {
+		lines = append(lines, render(fmt.Sprintf("  renamed %s → %s (%d%% similar)", header.OldPath, header.NewPath, header.Similarity)))
+	}
+	if header.IsCopy {
+		lines = append(lines, render(fmt.Sprintf("  copied %s → %s (%d%% similar)", header.OldPath, header.NewPath, header.Similarity)))
+	}
+	if header.OldMode != "" && header.NewMode != "" && header.OldMode != header.NewMode {
+		lines = append(lines, render(fmt.Sprintf("  mode changed %s → %s", header.OldMode, header.NewMode)))
+	}
+	if header.IsBinary {
+		lines = append(lines, render("  Binary file changed"))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, render("  No content changes"))
+	}
+	return lines
+}
 
-		// Apply syntax highlighting
-		highlighted := text
-		if fileRef != nil {
-			highlighted = fileRef.HighlightLine(lineIdx, text)
-		}
+// formatCommitHeader renders commit metadata as full-width lines in the style of git log
+func formatCommitHeader(commit *models.CommitInfo, fullWidth int) []string {
+	if commit == nil {
+		return nil
+	}
 
-		// Truncate if needed
-		visibleLen := len(utils.StripAnsi(highlighted))
-		if visibleLen > leftWidth {
-			// Truncate the original text and re-highlight safely
-			maxLen := min(len(text), leftWidth-3)
-			if maxLen < 0 {
-				maxLen = 0
-			}
-			text = text[:maxLen] + "..."
-			highlighted = text
-			if fileRef != nil {
-				highlighted = fileRef.HighlightLine(lineIdx, text)
-			}
-			visibleLen = len(utils.StripAnsi(highlighted))
-		}
+	render := func(style lipgloss.Style, text string) string {
+		return style.Render(utils.PadRight(utils.Truncate(text, fullWidth), fullWidth))
+	}
 
-		// Apply search highlighting if query matches
-		if searchQuery != "" && strings.Contains(strings.ToLower(text), strings.ToLower(searchQuery)) {
-			highlighted, _ = highlightSearchMatches(text, searchQuery, lineIdx)
-			visibleLen = len(utils.StripAnsi(highlighted))
+	var lines []string
+	if commit.Hash != "" {
+		lines = append(lines, render(styles.CommitHashStyle, "commit "+commit.Hash))
+	}
+	if commit.Author != "" {
+		lines = append(lines, render(styles.NeutralStyle, "Author: "+commit.Author))
+	}
+	if commit.Date != "" {
+		lines = append(lines, render(styles.NeutralStyle, "Date:   "+commit.Date))
+	}
+	lines = append(lines, render(styles.NeutralStyle, ""))
+	lines = append(lines, render(styles.HeaderStyle, "    "+commit.Subject))
+	if len(commit.Body) > 0 {
+		lines = append(lines, render(styles.NeutralStyle, ""))
+		for _, line := range commit.Body {
+			lines = append(lines, render(styles.NeutralStyle, "    "+line))
 		}
+	}
+	lines = append(lines, render(styles.NeutralStyle, ""))
 
-		// Apply background color directly with ANSI codes to preserve syntax highlighting
-		bgCode := "\x1b[48;2;61;30;30m" // #3d1e1e
-		resetBg := "\x1b[49m"
+	return lines
+}
 
-		// Pad to width
-		padding := leftWidth - visibleLen
-		if padding < 0 {
-			padding = 0
+// formatSubmoduleSummary renders a submodule change as full-width lines:
+// the old and new recorded commits followed by the commits between them
+func formatSubmoduleSummary(name string, sub *models.SubmoduleInfo, fullWidth int) []string {
+	render := func(style lipgloss.Style, text string) string {
+		return style.Render(utils.PadRight(utils.Truncate(text, fullWidth), fullWidth))
+	}
+	shortHash := func(hash string) string {
+		if hash == "" {
+			return "(none)"
 		}
+		if len(hash) > 7 {
+			return hash[:7]
+		}
+		return hash
+	}
 
-		lineNum := fmt.Sprintf("%5d ", *leftLineNum)
-		left := styles.LineNumBgLeft.Render(lineNum) + bgCode + highlighted + strings.Repeat(" ", padding) + resetBg
-
-		// Right side empty with neutral background, padded to rightWidth
-		emptyStyle := styles.NeutralStyle
-		right := "      " + emptyStyle.Render(strings.Repeat(" ", rightWidth))
-		*leftLineNum++
-		return left, right, false, false
+	newCommit := shortHash(sub.NewCommit)
+	if sub.Dirty {
+		newCommit += " (dirty)"
 	}
 
-	if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
-		// Added line - show on right only with syntax highlighting
-		text := line[1:]
+	lines := []string{
+		render(styles.HeaderStyle, "Submodule "+name),
+		render(styles.NeutralStyle, ""),
+		render(styles.LineNumBgLeft, "  old commit "+shortHash(sub.OldCommit)),
+		render(styles.LineNumBgRight, "  new commit "+newCommit),
+		render(styles.NeutralStyle, ""),
+	}
 
-		// Apply syntax highlighting
-		highlighted := text
-		if fileRef != nil {
-			highlighted = fileRef.HighlightLine(lineIdx, text)
+	if sub.Error != "" {
+		lines = append(lines, render(styles.NeutralStyle, "  "+sub.Error))
+	}
+	for _, entry := range sub.Log {
+		// "<" marks commits only in the old commit, ">" commits only in the new one
+		style := styles.SubmoduleAddedStyle
+		if strings.HasPrefix(entry, "<") {
+			style = styles.SubmoduleRemovedStyle
 		}
+		lines = append(lines, render(style, "  "+entry))
+	}
 
-		// Truncate if needed
-		visibleLen := len(utils.StripAnsi(highlighted))
-		if visibleLen > rightWidth {
-			// Truncate the original text and re-highlight safely
-			maxLen := min(len(text), rightWidth-3)
-			if maxLen < 0 {
-				maxLen = 0
-			}
-			text = text[:maxLen] + "..."
-			highlighted = text
-			if fileRef != nil {
-				highlighted = fileRef.HighlightLine(lineIdx, text)
-			}
-			visibleLen = len(utils.StripAnsi(highlighted))
-		}
+	if !sub.Expanded {
+		lines = append(lines, render(styles.NeutralStyle, ""))
+		lines = append(lines, render(styles.LineNumStyle, "  Press e to show the files changed inside submodules"))
+	}
 
-		// Apply search highlighting if query matches
-		if searchQuery != "" && strings.Contains(strings.ToLower(text), strings.ToLower(searchQuery)) {
-			highlighted, _ = highlightSearchMatches(text, searchQuery, lineIdx)
-			visibleLen = len(utils.StripAnsi(highlighted))
-		}
+	return lines
+}
 
-		// Apply background color directly with ANSI codes to preserve syntax highlighting
-		bgCode := "\x1b[48;2;30;61;30m" // #1e3d1e
-		resetBg := "\x1b[49m"
+// lineAt returns the hunk line at idx, or nil for the padded side of a row
+func lineAt(hunk models.Hunk, idx int) *models.DiffLine {
+	if idx < 0 {
+		return nil
+	}
+	return &hunk.Lines[idx]
+}
 
-		// Pad to width
-		padding := rightWidth - visibleLen
-		if padding < 0 {
-			padding = 0
+// formatSide formats one screen row of one side of a diff row at the given width
+// Removed lines only appear on the left, added lines on the right and context lines on both.
+// A nil line, or a wrapped part past the end of the line, renders as an empty padded cell
+func formatSide(m *models.Model, file *models.FileDiff, line *models.DiffLine, spans []models.Span, width int, isLeft bool, part int, mark string) string {
+	if line == nil || part >= wrappedParts(m, line.Display(), width) {
+		numbers := markedGutterStyle(lipgloss.NewStyle(), mark)
+		return numbers.Render("     ") + gutterMark(numbers, mark) + styles.NeutralStyle.Render(strings.Repeat(" ", width))
+	}
+
+	// Wrapped continuations keep the gutter color without repeating the number
+	gutter := strings.Repeat(" ", 5)
+	if part == 0 {
+		num := line.NewNum
+		if isLeft {
+			num = line.OldNum
 		}
+		gutter = fmt.Sprintf("%5d", num)
+	}
+	numbers := markedGutterStyle(gutterStyle(line), mark)
+	return numbers.Render(gutter) + gutterMark(numbers, mark) + formatCode(m, file, line, spans, width, part)
+}
 
-		lineNum := fmt.Sprintf("%5d ", *rightLineNum)
+// rowMark says how the gutter of a layout row is marked: "hunk" beside the lines of the selected hunk,
+// "visual" inside a visual selection, "cursor" on the row the selection is being extended from, or ""
+func rowMark(m *models.Model, idx int, row models.LayoutRow) string {
+	switch {
+	case m.Visual.Active && idx == m.Visual.Cursor:
+		return "cursor"
+	case m.Visual.Contains(idx):
+		return "visual"
+	case !m.Visual.Active && row.Hunk == m.HunkCursor:
+		return "hunk"
+	}
+	return ""
+}
 
-		// Left side empty with neutral background, padded to leftWidth
-		emptyStyle := styles.NeutralStyle
-		left := "      " + emptyStyle.Render(strings.Repeat(" ", leftWidth))
-		right := styles.LineNumBgRight.Render(lineNum) + bgCode + highlighted + strings.Repeat(" ", padding) + resetBg
-		*rightLineNum++
-		return left, right, false, false
+// sideMark returns the mark of one column of a side-by-side row; a selection narrowed to the other side leaves it unmarked
+func sideMark(m *models.Model, mark, side string) string {
+	if (mark == "visual" || mark == "cursor") && m.Visual.Side != "" && m.Visual.Side != side {
+		return ""
 	}
+	return mark
+}
 
-	// Context line - show on both sides with syntax highlighting
-	leftHighlighted := line
-	if fileRef != nil {
-		leftHighlighted = fileRef.HighlightLine(lineIdx, line)
+// markedGutterStyle returns the style of the line numbers of a row, highlighted inside a visual selection
+func markedGutterStyle(gutter lipgloss.Style, mark string) lipgloss.Style {
+	if mark == "visual" || mark == "cursor" {
+		return styles.VisualGutterStyle
 	}
-	rightHighlighted := leftHighlighted
+	return gutter
+}
 
-	// Truncate if needed for left side
-	leftVisibleLen := len(utils.StripAnsi(leftHighlighted))
-	leftLineText := line
-	if leftVisibleLen > leftWidth {
-		maxLen := min(len(line), leftWidth-3)
-		if maxLen < 0 {
-			maxLen = 0
-		}
-		leftLineText = line[:maxLen] + "..."
-		leftHighlighted = leftLineText
-		if fileRef != nil {
-			leftHighlighted = fileRef.HighlightLine(lineIdx, leftLineText)
-		}
-		leftVisibleLen = len(utils.StripAnsi(leftHighlighted))
+// gutterMark renders the last gutter column for a row's mark
+func gutterMark(gutter lipgloss.Style, mark string) string {
+	switch mark {
+	case "hunk":
+		return gutter.Foreground(styles.HunkCursorStyle.GetForeground()).Render("▌")
+	case "cursor":
+		return gutter.Render("▶")
+	default:
+		return gutter.Render(" ")
+	}
+}
+
+// wrappedParts returns how many screen rows a line takes at the given width
+func wrappedParts(m *models.Model, text string, width int) int {
+	if !m.WrapLines || width <= 0 {
+		return 1
+	}
+	return len(utils.WrapStarts(text, width))
+}
+
+// gutterStyle returns the line number style matching a line's kind
+func gutterStyle(line *models.DiffLine) lipgloss.Style {
+	switch line.Kind {
+	case models.LineRemoved:
+		return styles.LineNumBgLeft
+	case models.LineAdded:
+		return styles.LineNumBgRight
+	default:
+		return styles.LineNumStyle
 	}
+}
+
+// formatCode renders one screen row of a line's text with syntax highlighting, padded to width
+// Changed lines get a red or green background, with a stronger one over the changed spans.
+// The whole line is highlighted first, then cut by visible columns so escape codes stay intact:
+// the given wrapped part in wrap mode, otherwise the window starting at the horizontal scroll offset
+func formatCode(m *models.Model, file *models.FileDiff, line *models.DiffLine, spans []models.Span, width int, part int) string {
+	text := line.Display()
+	highlighted := file.HighlightLine(text)
 
-	// Truncate if needed for right side
-	rightVisibleLen := len(utils.StripAnsi(rightHighlighted))
-	rightLineText := line
-	if rightVisibleLen > rightWidth {
-		maxLen := min(len(line), rightWidth-3)
-		if maxLen < 0 {
-			maxLen = 0
+	// Apply search highlighting if query matches
+	searchQuery := m.DiffSearch.Query
+	if searchQuery != "" && strings.Contains(strings.ToLower(text), strings.ToLower(searchQuery)) {
+		highlighted, _ = highlightSearchMatches(text, searchQuery)
+	}
+
+	// Apply background color directly with ANSI codes to preserve syntax highlighting
+	var bgCode, resetBg string
+	if line.Kind != models.LineContext {
+		bgCode = "\x1b[48;2;30;61;30m"         // #1e3d1e
+		strongBgCode := "\x1b[48;2;46;107;46m" // #2e6b2e
+		if line.Kind == models.LineRemoved {
+			bgCode = "\x1b[48;2;61;30;30m"        // #3d1e1e
+			strongBgCode = "\x1b[48;2;120;46;46m" // #782e2e
 		}
-		rightLineText = line[:maxLen] + "..."
-		rightHighlighted = rightLineText
-		if fileRef != nil {
-			rightHighlighted = fileRef.HighlightLine(lineIdx, rightLineText)
+		resetBg = "\x1b[49m"
+		highlighted = applyBackground(highlighted, bgCode, strongBgCode, spans)
+	}
+
+	start, end := m.ScrollX, m.ScrollX+width
+	if m.WrapLines {
+		// Wrapped rows can end short of the width, leaving a wide character for the next row
+		starts := utils.WrapStarts(text, width)
+		start = starts[min(part, len(starts)-1)]
+		end = start + width
+		if part+1 < len(starts) {
+			end = min(end, starts[part+1])
 		}
-		rightVisibleLen = len(utils.StripAnsi(rightHighlighted))
 	}
+	visible := utils.SliceAnsi(highlighted, start, end)
 
-	// Apply search highlighting if query matches
-	if searchQuery != "" && strings.Contains(strings.ToLower(line), strings.ToLower(searchQuery)) {
-		leftHighlighted, _ = highlightSearchMatches(leftLineText, searchQuery, lineIdx)
-		rightHighlighted, _ = highlightSearchMatches(rightLineText, searchQuery, lineIdx)
-		leftVisibleLen = len(utils.StripAnsi(leftHighlighted))
-		rightVisibleLen = len(utils.StripAnsi(rightHighlighted))
-	}
-
-	leftNum := fmt.Sprintf("%5d ", *leftLineNum)
-	rightNum := fmt.Sprintf("%5d ", *rightLineNum)
-	left := styles.LineNumStyle.Render(leftNum) + styles.NeutralStyle.Render(utils.PadRight(leftHighlighted, leftWidth))
-	right := styles.LineNumStyle.Render(rightNum) + styles.NeutralStyle.Render(utils.PadRight(rightHighlighted, rightWidth))
-	*leftLineNum++
-	*rightLineNum++
-	return left, right, false, false
+	if line.Kind == models.LineContext {
+		return styles.NeutralStyle.Render(utils.PadRight(visible, width))
+	}
+	padding := max(width-utils.Width(visible), 0)
+	return visible + bgCode + strings.Repeat(" ", padding) + resetBg
 }
 
 // RenderDiffView renders the side-by-side diff view with static sidebar
@@ -415,21 +493,23 @@ func RenderDiffView(m *models.Model) string {
 	// Render tabs (always show, spanning full width)
 	var tabBar string
 	var tabs []string
+
+	// Lead with the revision range so it stays visible while switching files
+	if m.Range != "" {
+		tabs = append(tabs, styles.RangeLabelStyle.Render(m.Range))
+	}
 	for i, file := range m.Files {
 		style := styles.InactiveTabStyle
 		if i == m.ActiveTab {
 			style = styles.ActiveTabStyle
 		}
-		tabLabel := file.Name
-		if len(tabLabel) > 20 {
-			tabLabel = tabLabel[:17] + "..."
-		}
+		tabLabel := utils.Truncate(file.Name, 20)
 		tabs = append(tabs, style.Render(tabLabel))
 	}
 	tabBar = lipgloss.JoinHorizontal(lipgloss.Top, tabs...)
 
 	// Add gap to fill the full screen width
-	tabBarWidth := len(utils.StripAnsi(tabBar))
+	tabBarWidth := utils.Width(tabBar)
 	if tabBarWidth < m.Width {
 		gap := styles.TabGapStyle.Render(strings.Repeat(" ", m.Width-tabBarWidth))
 		tabBar = tabBar + gap
@@ -448,57 +528,41 @@ func RenderDiffView(m *models.Model) string {
 		verticalPadding := (m.Height - 3) / 2
 		content := strings.Repeat("\n", verticalPadding) + messageStyle.Render(m.NoDiffMessage)
 
+		// Keep the banner and help bar at the bottom
+		bottomPadding := m.Height - 3 - m.BannerHeight() - verticalPadding
+		content += strings.Repeat("\n", max(bottomPadding, 0))
+
 		// Render help bar
-		diffIndicator := getDiffTypeIndicator(m.DiffType)
-		rightHelp := fmt.Sprintf("a:auto-reload[%s] d:diff l:log%s q:quit", getAutoReloadStatus(m.AutoReloadEnabled), diffIndicator)
+		rightHelp := buildRightHelp(m, "d:diff", "l:log")
 		help := RenderHelpBarSplit("", rightHelp, m.Width)
 
-		return tabBar + content + "\n" + help
+		return tabBar + content + "\n" + renderStateBanner(m) + help
 	}
 
-	divider := styles.DividerStyle.Render("│")
-
-	leftView := m.LeftViewport.View()
-	rightView := m.RightViewport.View()
-
-	// Split into lines and join with divider
-	leftLines := strings.Split(leftView, "\n")
-	rightLines := strings.Split(rightView, "\n")
+	// Build diff content from the rows currently in view
+	body := renderVisibleRows(m)
 
-	var combined []string
-	maxLines := len(leftLines)
-	if len(rightLines) > maxLines {
-		maxLines = len(rightLines)
-	}
-
-	for i := 0; i < maxLines; i++ {
-		left := ""
-		right := ""
-		if i < len(leftLines) {
-			left = leftLines[i]
-		}
-		if i < len(rightLines) {
-			right = rightLines[i]
-		}
-
-		// If right is empty, this is a full-width header line
-		if right == "" && left != "" {
-			combined = append(combined, left)
-		} else {
-			combined = append(combined, left+divider+right)
+	// Render help bar with left and right sections
+	leftHelp := "↑↓:scroll h/←→:file 1-9:jump ]/[:hunk " + getStageIndicator(m) + "/:search " + getIntraLineIndicator(m) + " " + getWrapIndicator(m)
+	if m.Visual.Active {
+		sides := ""
+		if !m.IsUnified() {
+			sides = " ←→:side(" + cmp.Or(m.Visual.Side, "both") + ")"
 		}
+		leftHelp = fmt.Sprintf("VISUAL(%d lines) ↑↓:extend%s S:%s esc:cancel", len(m.SelectedLines()), sides, m.StageAction())
+	}
+	if conflict := m.ActiveConflict(); conflict != nil {
+		// Unmerged files are shown as their conflicts instead
+		body = renderConflictView(m, &m.Files[m.ActiveTab], conflict)
+		leftHelp = fmt.Sprintf("↑↓:scroll h/←→:file ]/[:conflict(%d/%d) O:ours T:theirs B:both R:resolve m:combined",
+			min(conflict.Active+1, conflict.Count()), conflict.Count())
+	} else if m.ActiveTab < len(m.Files) && m.Files[m.ActiveTab].Conflict != nil {
+		leftHelp += " m:conflicts"
 	}
-
-	// Build diff content
-	body := strings.Join(combined, "\n")
-
-	// Render help bar with left and right sections
-	leftHelp := "↑↓:scroll h/←→:file 1-9:jump /:search"
 	if m.DiffSearch.Query != "" {
 		leftHelp = fmt.Sprintf("↑↓:scroll n/N:match(%d/%d) esc:clear", m.DiffSearch.CurrentMatch+1, len(m.DiffSearch.Matches))
 	}
-	diffIndicator := getDiffTypeIndicator(m.DiffType)
-	rightHelp := fmt.Sprintf("a:auto-reload[%s] d:diff s:stats l:log%s q:quit", getAutoReloadStatus(m.AutoReloadEnabled), diffIndicator)
+	rightHelp := getLayoutIndicator(m) + " " + buildRightHelp(m, "d:diff", "s:stats", "l:log")
 
 	// Add search indicator if active
 	if m.DiffSearch.Query != "" {
@@ -508,7 +572,32 @@ func RenderDiffView(m *models.Model) string {
 
 	help := RenderHelpBarSplit(leftHelp, rightHelp, m.Width)
 
-	return fmt.Sprintf("%s%s\n%s", tabBar, body, help)
+	return fmt.Sprintf("%s%s\n%s%s", tabBar, body, renderStateBanner(m), help)
+}
+
+// renderStateBanner renders the operation in progress (e.g. "rebasing feature 3/7 onto abc1234")
+// and the notice about the last action as a full-width line, or returns "" when there's neither
+func renderStateBanner(m *models.Model) string {
+	// A pending confirmation or running command replaces the notice
+	notice := m.Notice
+	if m.Busy != "" {
+		notice = m.Spinner.View() + " " + m.Busy + "..."
+	}
+	if m.Confirm != nil {
+		notice = m.Confirm.Describe() + "? (y/n)"
+	}
+
+	var parts []string
+	for _, part := range []string{m.RepoState.Describe(), notice} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	text := strings.Join(parts, " · ")
+	return styles.StateBannerStyle.Width(m.Width).Render(utils.Truncate(" "+text, m.Width)) + "\n"
 }
 
 // RenderFilterInput renders the filter input overlay
@@ -0,0 +1,270 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"gg/src/diff"
+	"gg/src/models"
+	"gg/src/styles"
+	"gg/src/utils"
+)
+
+// UpdateContent prepares the diff view for the current file
+// The row layout is only recomputed when the file, width or a display option changed;
+// rows are formatted and highlighted lazily by renderVisibleRows, so scrolling costs O(screen height)
+func UpdateContent(m *models.Model) {
+	if len(m.Files) == 0 || m.ActiveTab >= len(m.Files) {
+		m.DiffLayout = nil
+		return
+	}
+
+	currentFile := &m.Files[m.ActiveTab]
+	if conflict := m.ActiveConflict(); conflict != nil {
+		updateConflictContent(m, currentFile, conflict)
+		return
+	}
+
+	key := models.LayoutKey{
+		File:      currentFile,
+		Set:       m.DiffType,
+		Path:      currentFile.Name,
+		Width:     m.Width,
+		Unified:   m.IsUnified(),
+		Wrap:      m.WrapLines,
+		IntraLine: m.IntraLineMode,
+		Query:     m.DiffSearch.Query,
+	}
+
+	if m.DiffLayout == nil || m.DiffLayout.Key != key {
+		// Start at the top when switching files; keep the position when only the display changed
+		// or the same file was reloaded, as background loading and refreshes replace every file
+		old := m.DiffLayout
+		sameFile := old != nil && old.Key.Set == key.Set && old.Key.Path == key.Path
+		if !sameFile {
+			m.LeftViewport.YOffset = 0
+			m.RightViewport.YOffset = 0
+		}
+
+		m.DiffLayout = buildLayout(m, currentFile, key)
+
+		// Selected rows only carry over when the same file was reloaded into the same rows
+		reloaded := false
+		if sameFile {
+			oldKey := old.Key
+			oldKey.File = currentFile
+			reloaded = oldKey == key && len(old.Rows) == len(m.DiffLayout.Rows)
+		}
+		if !reloaded {
+			m.Visual = models.VisualSelection{}
+		}
+
+		// The viewport only tracks the scroll position; it holds blank lines standing in for the rows
+		m.LeftViewport.SetContent(strings.Repeat("\n", max(len(m.DiffLayout.Rows)-1, 0)))
+		m.RightViewport.SetContent("")
+		m.RightViewport.YOffset = m.LeftViewport.YOffset
+	}
+
+	// Keep the horizontal scroll offset within the longest line of the file
+	m.ScrollX = max(min(m.ScrollX, m.DiffLayout.Longest-contentWidth(m)), 0)
+
+	keepHunkCursorVisible(m, currentFile)
+}
+
+// keepHunkCursorVisible moves the hunk cursor to the first hunk on screen once scrolling left the selected one out of view
+func keepHunkCursorVisible(m *models.Model, file *models.FileDiff) {
+	m.HunkCursor = max(min(m.HunkCursor, len(file.Hunks)-1), 0)
+
+	rows := m.DiffLayout.Rows
+	start := min(m.LeftViewport.YOffset, len(rows))
+	end := min(start+m.LeftViewport.Height, len(rows))
+	first := -1
+	for _, row := range rows[start:end] {
+		if row.Kind == models.RowBanner {
+			continue
+		}
+		if row.Hunk == m.HunkCursor {
+			return
+		}
+		if first < 0 {
+			first = row.Hunk
+		}
+	}
+	if first >= 0 {
+		m.HunkCursor = first
+	}
+}
+
+// contentWidth returns the width of the code area of the narrowest diff column
+func contentWidth(m *models.Model) int {
+	if m.IsUnified() {
+		return m.LeftViewport.Width - 12 // -12 for old and new line numbers
+	}
+	return min(m.LeftViewport.Width, m.RightViewport.Width) - 6 // -6 for line numbers ("12345 ")
+}
+
+// buildLayout computes the rows of the diff view for a file
+// It also collects search matches and intra-line spans, which only change along with the layout
+func buildLayout(m *models.Model, file *models.FileDiff, key models.LayoutKey) *models.DiffLayout {
+	layout := &models.DiffLayout{Key: key}
+	m.DiffSearch.Matches = nil
+
+	// Calculate full width for headers (full screen width minus center divider)
+	fullWidth := m.Width - 1
+	banner := func(lines []string) {
+		for _, line := range lines {
+			layout.Rows = append(layout.Rows, models.LayoutRow{Kind: models.RowBanner, Banner: line})
+		}
+	}
+
+	// Submodules show their recorded commits and the log between them instead of raw content
+	if file.Submodule != nil {
+		banner(formatSubmoduleSummary(file.Name, file.Submodule, fullWidth))
+		return layout
+	}
+
+	// Patches from git format-patch carry their commit metadata; show it above the diff
+	banner(formatCommitHeader(file.Commit, fullWidth))
+
+	// Files without hunks (binary, pure renames, mode changes) get a short description instead
+	if len(file.Hunks) == 0 {
+		banner(formatFileSummary(file.Header, fullWidth))
+	}
+
+	leftWidth := m.LeftViewport.Width - 6
+	rightWidth := m.RightViewport.Width - 6
+	unifiedWidth := m.LeftViewport.Width - 12
+	searchQuery := strings.ToLower(m.DiffSearch.Query)
+
+	for hunkIdx, hunk := range file.Hunks {
+		// Untracked files are a single synthetic hunk; its header adds nothing
+		if file.Status != "Untracked" {
+			layout.Rows = append(layout.Rows, models.LayoutRow{Kind: models.RowHunkHeader, Hunk: hunkIdx})
+		}
+
+		for lineIdx, line := range hunk.Lines {
+			layout.Longest = max(layout.Longest, utils.Width(line.Display()))
+			if searchQuery != "" && strings.Contains(strings.ToLower(line.Display()), searchQuery) {
+				m.DiffSearch.Matches = append(m.DiffSearch.Matches, models.SearchMatch{Hunk: hunkIdx, Line: lineIdx, Col: 0})
+			}
+		}
+
+		// The unified layout keeps the hunk's own line order in a single column
+		if key.Unified {
+			spans := unifiedSpans(m, hunk)
+			for lineIdx, line := range hunk.Lines {
+				for part := 0; part < wrappedParts(m, line.Display(), unifiedWidth); part++ {
+					layout.Rows = append(layout.Rows, models.LayoutRow{
+						Kind: models.RowUnified, Hunk: hunkIdx, Line: lineIdx, Part: part,
+						OldSpans: spans[lineIdx],
+					})
+				}
+			}
+			continue
+		}
+
+		// Removed and added lines of a change block share rows, so old and new versions sit side by side
+		for _, row := range hunk.Rows() {
+			// Emphasize the words or characters that changed between a paired removal and addition
+			var oldSpans, newSpans []models.Span
+			if row.Old >= 0 && row.New >= 0 && row.Old != row.New {
+				oldSpans, newSpans = diff.ChangedSpans(hunk.Lines[row.Old].Display(), hunk.Lines[row.New].Display(), m.IntraLineMode == "char")
+			}
+
+			// Wrapped sides can differ in height; the shorter one is padded with blank cells
+			parts := 1
+			if row.Old >= 0 {
+				parts = max(parts, wrappedParts(m, hunk.Lines[row.Old].Display(), leftWidth))
+			}
+			if row.New >= 0 {
+				parts = max(parts, wrappedParts(m, hunk.Lines[row.New].Display(), rightWidth))
+			}
+			for part := 0; part < parts; part++ {
+				layout.Rows = append(layout.Rows, models.LayoutRow{
+					Kind: models.RowSplit, Hunk: hunkIdx, Old: row.Old, New: row.New, Part: part,
+					OldSpans: oldSpans, NewSpans: newSpans,
+				})
+			}
+		}
+	}
+
+	return layout
+}
+
+// unifiedSpans maps each paired line of a hunk to its changed spans for the unified layout
+func unifiedSpans(m *models.Model, hunk models.Hunk) map[int][]models.Span {
+	spans := make(map[int][]models.Span)
+	for _, row := range hunk.Rows() {
+		if row.Old >= 0 && row.New >= 0 && row.Old != row.New {
+			spans[row.Old], spans[row.New] = diff.ChangedSpans(hunk.Lines[row.Old].Display(), hunk.Lines[row.New].Display(), m.IntraLineMode == "char")
+		}
+	}
+	return spans
+}
+
+// renderVisibleRows formats the layout rows inside the viewport window into screen lines
+func renderVisibleRows(m *models.Model) string {
+	height := m.LeftViewport.Height
+	blank := strings.Repeat(" ", m.Width)
+	if m.DiffLayout == nil || m.ActiveTab >= len(m.Files) {
+		return strings.TrimSuffix(strings.Repeat(blank+"\n", height), "\n")
+	}
+
+	file := &m.Files[m.ActiveTab]
+	rows := m.DiffLayout.Rows
+	start := min(m.LeftViewport.YOffset, len(rows))
+	end := min(start+height, len(rows))
+
+	divider := styles.DividerStyle.Render("│")
+	leftWidth := m.LeftViewport.Width - 6
+	rightWidth := m.RightViewport.Width - 6
+
+	lines := make([]string, 0, height)
+	for i, row := range rows[start:end] {
+		mark := rowMark(m, start+i, row)
+		switch row.Kind {
+		case models.RowBanner:
+			lines = append(lines, utils.PadRight(row.Banner, m.Width))
+		case models.RowHunkHeader:
+			style := styles.HeaderStyle
+			if row.Hunk == m.HunkCursor {
+				style = styles.SelectedHunkStyle
+			}
+			header := file.Hunks[row.Hunk].Header
+			lines = append(lines, style.Render(utils.PadRight(utils.Truncate(header, m.Width-1), m.Width-1))+" ")
+		case models.RowSplit:
+			hunk := file.Hunks[row.Hunk]
+			left := formatSide(m, file, lineAt(hunk, row.Old), row.OldSpans, leftWidth, true, row.Part, sideMark(m, mark, "old"))
+			right := formatSide(m, file, lineAt(hunk, row.New), row.NewSpans, rightWidth, false, row.Part, sideMark(m, mark, "new"))
+			lines = append(lines, left+divider+right)
+		case models.RowUnified:
+			lines = append(lines, formatUnifiedRow(m, file, row, m.LeftViewport.Width-12, mark))
+		}
+	}
+
+	// Fill the rest of the screen below the last row
+	for len(lines) < height {
+		lines = append(lines, blank)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatUnifiedRow formats a unified layout row with old and new line number gutters
+func formatUnifiedRow(m *models.Model, file *models.FileDiff, row models.LayoutRow, width int, mark string) string {
+	line := &file.Hunks[row.Hunk].Lines[row.Line]
+
+	number := func(num int) string {
+		if num == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d", num)
+	}
+
+	// Wrapped continuations keep the gutter color without repeating the numbers
+	gutter := strings.Repeat(" ", 11)
+	if row.Part == 0 {
+		gutter = fmt.Sprintf("%5s %5s", number(line.OldNum), number(line.NewNum))
+	}
+	numbers := markedGutterStyle(gutterStyle(line), mark)
+	return numbers.Render(gutter) + gutterMark(numbers, mark) + formatCode(m, file, line, row.OldSpans, width, row.Part)
+}
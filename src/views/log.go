@@ -1,10 +1,9 @@
 package views
 
 import (
-	"fmt"
-	"os/exec"
 	"strings"
 
+	"gg/src/io"
 	"gg/src/models"
 	"gg/src/styles"
 	"gg/src/utils"
@@ -15,26 +14,26 @@ import (
 
 // UpdateLogContent populates the log viewport with git log data
 func UpdateLogContent(m *models.Model) {
-	// Guard against uninitialized dimensions
-	if m.Width == 0 {
+	// Guard against uninitialized dimensions and sessions without a repository
+	if m.Width == 0 || m.Repo == nil {
 		return
 	}
 
 	// Get HEAD commit hash
-	headCmd := exec.Command("git", "rev-parse", "--short", "HEAD")
+	headCmd := m.Repo.Command("rev-parse", "--short", "HEAD")
 	headOutput, _ := headCmd.Output()
 	headHash := strings.TrimSpace(string(headOutput))
 
 	// Get upstream branch commit hash
 	// First, try to get the upstream branch for current branch
-	upstreamCmd := exec.Command("git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	upstreamCmd := m.Repo.Command("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
 	upstreamOutput, err := upstreamCmd.Output()
 	originHash := ""
 
 	if err == nil && len(upstreamOutput) > 0 {
 		// Got upstream branch name, now get its commit hash
 		upstreamBranch := strings.TrimSpace(string(upstreamOutput))
-		originCmd := exec.Command("git", "rev-parse", "--short", upstreamBranch)
+		originCmd := m.Repo.Command("rev-parse", "--short", upstreamBranch)
 		originOutput, err := originCmd.Output()
 		if err == nil {
 			originHash = strings.TrimSpace(string(originOutput))
@@ -44,7 +43,7 @@ func UpdateLogContent(m *models.Model) {
 	// Fallback: try common remote branch names if no upstream configured
 	if originHash == "" {
 		for _, remoteBranch := range []string{"origin/master", "origin/main"} {
-			originCmd := exec.Command("git", "rev-parse", "--short", remoteBranch)
+			originCmd := m.Repo.Command("rev-parse", "--short", remoteBranch)
 			originOutput, err := originCmd.Output()
 			if err == nil && len(originOutput) > 0 {
 				originHash = strings.TrimSpace(string(originOutput))
@@ -54,7 +53,8 @@ func UpdateLogContent(m *models.Model) {
 	}
 
 	// Build git log command with filters
-	args := []string{"log", "--graph", "--color=always", "--all", "--decorate=short",
+	// Content saved by discards is kept under private refs that aren't part of the history
+	args := []string{"log", "--graph", "--color=always", "--exclude=" + io.TrashRefs + "*", "--all", "--decorate=short",
 		"--pretty=format:%Cred%h%Creset - %d %s %Cgreen(%cr)%Creset %C(bold blue)<%an>%Creset", "--abbrev-commit"}
 
 	// Add filter arguments
@@ -68,11 +68,15 @@ func UpdateLogContent(m *models.Model) {
 		args = append(args, "--until="+m.LogFilters.DateTo)
 	}
 	// Add path filter at the end (after --)
+	// Without an explicit path filter, fall back to the session's pathspecs
 	if m.LogFilters.Path != "" {
 		args = append(args, "--", m.LogFilters.Path)
+	} else if len(m.Pathspecs) > 0 {
+		args = append(args, "--")
+		args = append(args, m.Pathspecs...)
 	}
 
-	cmd := exec.Command("git", args...)
+	cmd := m.Repo.Command(args...)
 	output, err := cmd.Output()
 
 	var logLines []string
@@ -240,9 +244,9 @@ func UpdateLogContent(m *models.Model) {
 			"graph":   graphPrefix,
 			"branch":  localBranch,
 			"origin":  originBranch,
-			"message": message,
+			"message": utils.ExpandTabs(message),
 			"time":    time,
-			"author":  author,
+			"author":  utils.ExpandTabs(author),
 		})
 
 		// Apply color styling for special commits
@@ -306,8 +310,8 @@ func UpdateLogContent(m *models.Model) {
 	}
 
 	// Calculate page size based on available height
-	// Reserve space for: header row (3 lines with borders), help bar (1 line), and padding
-	pageSize := m.Height - 5
+	// Reserve space for: header row (3 lines with borders), help bar (1 line), state banner, and padding
+	pageSize := m.Height - 5 - m.BannerHeight()
 	if pageSize < 5 {
 		pageSize = 5 // minimum page size
 	}
@@ -349,8 +353,7 @@ func RenderLogView(m *models.Model) string {
 
 	// Render help bar with left and right sections
 	leftHelp := "↑↓:scroll /:search ^a:author ^p:path ^l:clear"
-	diffIndicator := getDiffTypeIndicator(m.DiffType)
-	rightHelp := fmt.Sprintf("a:auto-reload[%s] d:diff s:stats l:log%s q:quit", getAutoReloadStatus(m.AutoReloadEnabled), diffIndicator)
+	rightHelp := buildRightHelp(m, "d:diff", "s:stats", "l:log")
 	if filterIndicator != "" {
 		rightHelp = filterIndicator + " " + rightHelp
 	}
@@ -358,7 +361,7 @@ func RenderLogView(m *models.Model) string {
 
 	// Calculate heights
 	tableHeight := lipgloss.Height(tableView)
-	helpHeight := 1 // Help bar is always 1 line
+	helpHeight := 1 + m.BannerHeight() // Help bar is always 1 line, with the state banner above it
 
 	// Calculate vertical padding to center table, then fill to bottom
 	availableHeight := m.Height - helpHeight
@@ -378,6 +381,7 @@ func RenderLogView(m *models.Model) string {
 	output.WriteString(tableView)
 	output.WriteString(strings.Repeat("\n", bottomPadding))
 	output.WriteString("\n")
+	output.WriteString(renderStateBanner(m))
 	output.WriteString(help)
 
 	return output.String()
@@ -7,6 +7,7 @@ import (
 
 	"gg/src/models"
 	"gg/src/styles"
+	"gg/src/utils"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/evertras/bubble-table/table"
@@ -21,10 +22,14 @@ func getStatusStyle(status string) lipgloss.Style {
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("9")) // Red
 	case "Renamed":
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("11")) // Yellow
+	case "Copied":
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("14")) // Cyan
 	case "Modified":
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("12")) // Blue
 	case "Untracked":
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("13")) // Magenta
+	case "Unmerged":
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true) // Dark red
 	default:
 		return lipgloss.NewStyle() // Default
 	}
@@ -32,13 +37,18 @@ func getStatusStyle(status string) lipgloss.Style {
 
 // UpdateStatsContent initializes the stats table (should only be called once)
 func UpdateStatsContent(m *models.Model) {
-	// Calculate column widths to fill full screen width first
-	// Reserve space for borders and spacing (approximate: 5 chars for borders/separators)
-	availableWidth := m.Width - 5
+	// The file column takes the screen width left by the fixed columns and the borders:
+	// one on the left of every column and one closing the table on the right
+	markWidth := 1
 	statusWidth := 8
+	stageWidth := 10
 	addedWidth := 12
 	removedWidth := 12
-	fileWidth := availableWidth - statusWidth - addedWidth - removedWidth
+	fixedWidths := []int{markWidth, statusWidth, stageWidth, addedWidth, removedWidth}
+	fileWidth := m.Width - (len(fixedWidths) + 2)
+	for _, width := range fixedWidths {
+		fileWidth -= width
+	}
 
 	// Build table rows with filtering
 	rows := []table.Row{}
@@ -74,22 +84,44 @@ func UpdateStatsContent(m *models.Model) {
 		statusLetter := string(file.Status[0])
 		styledStatus := getStatusStyle(file.Status).Render(statusLetter)
 
+		// Files inside a submodule are listed under it; the submodule row already rolls up their counts
+		fileLabel := file.Name
+		if file.Parent != "" {
+			fileLabel = "  └ " + strings.TrimPrefix(file.Name, file.Parent+"/")
+		} else if file.Submodule != nil {
+			fileLabel += " (submodule)"
+		}
+
+		// Files picked for a batch action are checked
+		mark := ""
+		if m.StatsSelected[file.Name] {
+			mark = styles.StatsPickedStyle.Render("✓")
+		}
+
 		rows = append(rows, table.NewRow(table.RowData{
-			"file":    file.Name,
+			"name":    file.Name,
+			"mark":    mark,
+			"file":    utils.ExpandTabs(fileLabel),
 			"status":  styledStatus,
+			"stage":   file.Stage,
 			"added":   file.Additions,
 			"removed": file.Deletions,
 		}))
 
+		filteredCount++
+		if file.Parent != "" {
+			continue
+		}
 		totalAdditions += file.Additions
 		totalDeletions += file.Deletions
-		filteredCount++
 	}
 
 	// Add separator line before Total - use calculated widths to extend end to end
 	rows = append(rows, table.NewRow(table.RowData{
+		"mark":    strings.Repeat("─", markWidth),
 		"file":    strings.Repeat("─", fileWidth),
 		"status":  strings.Repeat("─", statusWidth),
+		"stage":   strings.Repeat("─", stageWidth),
 		"added":   strings.Repeat("─", addedWidth),
 		"removed": strings.Repeat("─", removedWidth),
 	}))
@@ -107,28 +139,34 @@ func UpdateStatsContent(m *models.Model) {
 	}
 
 	rows = append(rows, table.NewRow(table.RowData{
+		"mark":    "",
 		"file":    totalLabel,
 		"status":  "",
+		"stage":   "",
 		"added":   totalAdditions,
 		"removed": totalDeletions,
 	}))
 
 	// Define table columns - dynamically sized to fill full width
 	columns := []table.Column{
+		table.NewColumn("mark", "", markWidth),
 		table.NewColumn("file", "File", fileWidth),
 		table.NewColumn("status", "Status", statusWidth).WithStyle(lipgloss.NewStyle().Align(lipgloss.Center)),
+		table.NewColumn("stage", "Stage", stageWidth).WithStyle(lipgloss.NewStyle().Align(lipgloss.Center)),
 		table.NewColumn("added", "Added", addedWidth).WithStyle(lipgloss.NewStyle().Align(lipgloss.Right).Foreground(lipgloss.Color("10"))),
 		table.NewColumn("removed", "Removed", removedWidth).WithStyle(lipgloss.NewStyle().Align(lipgloss.Right).Foreground(lipgloss.Color("9"))),
 	}
 
 	// Calculate page size based on available height
-	// Reserve space for: header row (3 lines with borders), help bar (1 line), and padding
-	pageSize := m.Height - 5
+	// Reserve space for: header row (3 lines with borders), help bar (1 line), state banner, and padding
+	pageSize := m.Height - 5 - m.BannerHeight()
 	if pageSize < 5 {
 		pageSize = 5 // minimum page size
 	}
 
 	// Create table with custom styles - dynamic page size based on terminal height
+	// The highlighted row is kept when the table is rebuilt, e.g. after a batch action
+	highlighted := m.StatsTable.GetHighlightedRowIndex()
 	m.StatsTable = table.New(columns).
 		WithRows(rows).
 		Focused(true).
@@ -136,7 +174,8 @@ func UpdateStatsContent(m *models.Model) {
 		HeaderStyle(styles.TableHeaderStyle).
 		WithBaseStyle(styles.TableBaseStyle).
 		WithPageSize(pageSize).
-		WithFooterVisibility(false)
+		WithFooterVisibility(false).
+		WithHighlightedRow(highlighted)
 }
 
 // RenderStatsView renders the stats view with a clean modern interface using bubble-table
@@ -159,11 +198,10 @@ func RenderStatsView(m *models.Model) string {
 		content := strings.Repeat("\n", verticalPadding) + messageStyle.Render(m.NoDiffMessage)
 
 		// Render help bar
-		diffIndicator := getDiffTypeIndicator(m.DiffType)
-		rightHelp := fmt.Sprintf("a:auto-reload[%s] l:log%s q:quit", getAutoReloadStatus(m.AutoReloadEnabled), diffIndicator)
+		rightHelp := buildRightHelp(m, "l:log")
 		help := RenderHelpBarSplit("", rightHelp, m.Width)
 
-		return content + "\n" + help
+		return content + "\n" + renderStateBanner(m) + help
 	}
 
 	// Render table and help bar
@@ -174,8 +212,13 @@ func RenderStatsView(m *models.Model) string {
 
 	// Render help bar with left and right sections
 	leftHelp := "↑↓:scroll M-s:status M-e:ext ^l:clear"
-	diffIndicator := getDiffTypeIndicator(m.DiffType)
-	rightHelp := fmt.Sprintf("a:auto-reload[%s] d:diff s:stats l:log%s q:quit", getAutoReloadStatus(m.AutoReloadEnabled), diffIndicator)
+	if m.HasRepository() && m.Range == "" {
+		leftHelp += " space:pick S:stage U:unstage X:discard D:delete I:ignore z:undo Z:trash"
+		if len(m.StatsSelected) > 0 {
+			leftHelp = fmt.Sprintf("picked:%d %s", len(m.StatsSelected), leftHelp)
+		}
+	}
+	rightHelp := buildRightHelp(m, "d:diff", "s:stats", "l:log")
 	if filterIndicator != "" {
 		rightHelp = filterIndicator + " " + rightHelp
 	}
@@ -183,7 +226,7 @@ func RenderStatsView(m *models.Model) string {
 
 	// Calculate heights
 	tableHeight := lipgloss.Height(tableView)
-	helpHeight := 1 // Help bar is always 1 line
+	helpHeight := 1 + m.BannerHeight() // Help bar is always 1 line, with the state banner above it
 
 	// Calculate vertical padding to center table, then fill to bottom
 	availableHeight := m.Height - helpHeight
@@ -203,6 +246,7 @@ func RenderStatsView(m *models.Model) string {
 	output.WriteString(tableView)
 	output.WriteString(strings.Repeat("\n", bottomPadding))
 	output.WriteString("\n")
+	output.WriteString(renderStateBanner(m))
 	output.WriteString(help)
 
 	return output.String()
@@ -0,0 +1,48 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"gg/src/models"
+	"gg/src/styles"
+	"gg/src/utils"
+)
+
+// RenderTrashView renders the trash browser: the saved discards, newest first, above the paths of the selected one
+func RenderTrashView(m *models.Model) string {
+	trash := &m.Trash
+	height := m.Height - 2 - m.BannerHeight() // Header line and help bar
+	listHeight := min(len(trash.Entries), max(height/2, 1))
+
+	var rows []string
+	title := fmt.Sprintf(" Discarded changes (%d kept, newest first)", len(trash.Entries))
+	rows = append(rows, styles.HeaderStyle.Render(utils.PadRight(utils.Truncate(title, m.Width), m.Width)))
+
+	// Scroll the list so the selected entry stays visible
+	start := max(trash.Cursor-listHeight+1, 0)
+	for i := start; i < start+listHeight; i++ {
+		entry := trash.Entries[i]
+		text := fmt.Sprintf(" %s  %s", entry.Time.Format("Jan _2 15:04:05"), entry.Summary)
+		text = utils.PadRight(utils.Truncate(text, m.Width), m.Width)
+		if i == trash.Cursor {
+			text = styles.TrashSelectedStyle.Render(text)
+		}
+		rows = append(rows, text)
+	}
+
+	// The paths the selected entry restores
+	rows = append(rows, styles.DividerStyle.Render(strings.Repeat("─", m.Width)))
+	for _, path := range trash.Entries[trash.Cursor].Paths {
+		if len(rows) >= height {
+			break
+		}
+		rows = append(rows, utils.Truncate("   "+path, m.Width))
+	}
+	for len(rows) < height+1 {
+		rows = append(rows, "")
+	}
+
+	help := RenderHelpBarSplit("↑↓:select enter:restore esc:close", "q:quit", m.Width)
+	return strings.Join(rows, "\n") + "\n" + renderStateBanner(m) + help
+}
@@ -1,95 +1,404 @@
 package watcher
 
 import (
-	"os/exec"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
+
+	"gg/src/repo"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/fsnotify/fsnotify"
 )
 
-type GitChangeMsg struct{}
+const (
+	// debounceDelay is how long the tree must stay quiet before changes are reported
+	// An editor save fires several events within a few milliseconds
+	debounceDelay = 150 * time.Millisecond
+
+	// maxDelay bounds how long changes are held back while events keep arriving
+	maxDelay = time.Second
+)
+
+// GitChangeMsg reports a batch of changes coalesced over the debounce window or poll interval
+type GitChangeMsg struct {
+	Paths   []string // Changed worktree paths, relative to the repository root and sorted
+	Full    bool     // Git state (index, HEAD, refs or an operation in progress) changed, or paths couldn't be scoped; reload everything
+	Backend string   // Backend that detected the changes: "fsnotify" or "poll"
+}
+
+// Watcher is a long-lived file watcher sending debounced GitChangeMsgs
+// It uses file system notifications, or polls git when those are unavailable
+type Watcher struct {
+	ctx       *repo.Context
+	pathspecs []string
+	backend   string        // Backend chosen at start: "fsnotify" or "poll"
+	fallback  bool          // Switch to polling if the notification watch limit is reached
+	interval  time.Duration // Time between checks of the polling backend
+	fs        *fsnotify.Watcher
+	dirs      map[string]bool // Watched worktree directories
+	gitDirs   map[string]bool // Watched git state directories
+	exhausted bool            // Adding a watch hit the system's limit
+	changes   chan GitChangeMsg
+}
+
+// Start watches git state and every directory of the worktree that isn't ignored until the program exits
+// Non-empty pathspecs limit the watched directories and reported paths to the matching part of the tree
+// Git state is located through the repository context, so linked worktrees and submodules work too
+// backend is "fsnotify", "poll", or "auto" to use file system notifications and fall back to polling
+// every interval when they can't be created or the watch limit is reached
+func Start(ctx *repo.Context, pathspecs []string, backend string, interval time.Duration) (*Watcher, error) {
+	w := &Watcher{
+		ctx:       ctx,
+		pathspecs: pathspecs,
+		backend:   backend,
+		fallback:  backend == "auto",
+		interval:  interval,
+		dirs:      make(map[string]bool),
+		gitDirs:   make(map[string]bool),
+		changes:   make(chan GitChangeMsg),
+	}
+	if backend == "poll" {
+		go w.poll()
+		return w, nil
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		if !w.fallback {
+			return nil, err
+		}
+		w.backend = "poll"
+		go w.poll()
+		return w, nil
+	}
+	w.backend = "fsnotify"
+	w.fs = fsWatcher
+
+	// Git replaces the index, HEAD and refs by renaming lock files, which drops watches on
+	// the files themselves, so their directories are watched instead
+	// index and HEAD belong to the worktree, refs are shared between worktrees
+	gitDirs := []string{
+		ctx.GitDir,
+		ctx.CommonPath("refs/heads"),
+		ctx.CommonPath("refs/remotes"),
+		ctx.CommonPath("refs/remotes/origin"), // Watch origin remotes specifically
+	}
+	for _, dir := range gitDirs {
+		w.addGitDir(dir)
+	}
+	// A rebase in progress records its progress in its own directory
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		if info, err := os.Stat(ctx.GitPath(name)); err == nil && info.IsDir() {
+			w.addGitDir(ctx.GitPath(name))
+		}
+	}
+
+	w.watchTree(".")
+	if w.exhausted && w.fallback {
+		fsWatcher.Close()
+		w.backend = "poll"
+		go w.poll()
+		return w, nil
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Backend returns the backend the watcher started with: "fsnotify" or "poll"
+// A later switch to polling is reported in GitChangeMsg.Backend
+func (w *Watcher) Backend() string {
+	return w.backend
+}
 
-func WatchGitChanges() tea.Cmd {
+// Wait returns a command receiving the next batch of changes
+func (w *Watcher) Wait() tea.Cmd {
 	return func() tea.Msg {
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			// If we can't create watcher, just return nil - app continues without auto-reload
+		return <-w.changes
+	}
+}
+
+// watchTree watches every directory of the worktree below rel (relative to the root), skipping
+// ignored directories, nested repositories and directories outside the pathspecs
+// Directories are never skipped for glob or magic pathspecs, which may match files anywhere
+// Watching directories rather than files handles editors that use atomic saves (create temp file, rename)
+func (w *Watcher) watchTree(rel string) {
+	ignored := w.ignoredDirs(rel)
+
+	filepath.WalkDir(w.ctx.Path(rel), func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
 			return nil
 		}
-		defer watcher.Close()
-
-		// Watch git directory files for staging/commit changes
-		gitPaths := []string{
-			filepath.Join(".git", "index"),
-			filepath.Join(".git", "HEAD"),
-			filepath.Join(".git", "refs", "heads"),
-			filepath.Join(".git", "refs", "remotes"),
-			filepath.Join(".git", "refs", "remotes", "origin"), // Watch origin remotes specifically
+		rel, relErr := filepath.Rel(w.ctx.Toplevel, dir)
+		if relErr != nil {
+			return filepath.SkipDir
 		}
+		rel = filepath.ToSlash(rel)
 
-		for _, path := range gitPaths {
-			if err := watcher.Add(path); err != nil {
-				// If specific path fails, continue - watch what we can
-				continue
+		if rel != "." {
+			if entry.Name() == ".git" || ignored[rel] || matchPathspecs(rel, w.pathspecs) == matchNone {
+				return filepath.SkipDir
+			}
+			// Submodules and nested repositories have their own ignore rules and git state
+			if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+				return filepath.SkipDir
 			}
 		}
+		w.addDir(dir)
+		return nil
+	})
+}
 
-		// Get all tracked files and watch their parent directories
-		// This handles editors that use atomic saves (create temp file, rename)
-		cmd := exec.Command("git", "ls-files")
-		output, err := cmd.Output()
-		if err == nil {
-			// Track unique directories to avoid adding the same directory multiple times
-			dirsToWatch := make(map[string]bool)
-
-			files := strings.Split(strings.TrimSpace(string(output)), "\n")
-			for _, file := range files {
-				if file != "" {
-					// Get the directory containing this file
-					dir := filepath.Dir(file)
-					if dir == "" || dir == "." {
-						// File is in root directory, watch current directory
-						dir = "."
-					}
-					dirsToWatch[dir] = true
-				}
-			}
+// ignoredDirs lists the ignored directories below rel, relative to the root
+// git collapses each fully ignored directory into one entry, so build output isn't listed file by file
+func (w *Watcher) ignoredDirs(rel string) map[string]bool {
+	ignored := make(map[string]bool)
+	output, err := w.ctx.Command("ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory", "--", rel).Output()
+	if err != nil {
+		return ignored
+	}
+	for _, entry := range strings.Split(string(output), "\x00") {
+		if strings.HasSuffix(entry, "/") {
+			ignored[strings.TrimSuffix(entry, "/")] = true
+		}
+	}
+	return ignored
+}
 
-			// Add all unique directories to watcher
-			for dir := range dirsToWatch {
-				if err := watcher.Add(dir); err != nil {
-					// If specific directory fails, continue - watch what we can
-					continue
-				}
+// dropIgnored removes paths matched by .gitignore and the other exclude files from a batch
+// Tracked files are never reported as ignored
+func (w *Watcher) dropIgnored(paths map[string]bool) {
+	if len(paths) == 0 {
+		return
+	}
+	var input strings.Builder
+	for p := range paths {
+		input.WriteString(p)
+		input.WriteByte(0)
+	}
+
+	cmd := w.ctx.Command("check-ignore", "-z", "--stdin")
+	cmd.Stdin = strings.NewReader(input.String())
+	// check-ignore exits with 1 when nothing is ignored
+	output, _ := cmd.Output()
+	for _, p := range strings.Split(string(output), "\x00") {
+		delete(paths, p)
+	}
+}
+
+// addGitDir watches a git state directory
+func (w *Watcher) addGitDir(dir string) {
+	// If a specific path fails, continue - watch what we can
+	if err := w.fs.Add(dir); err == nil {
+		w.gitDirs[dir] = true
+	}
+}
+
+// addDir watches a worktree directory once
+func (w *Watcher) addDir(dir string) {
+	if w.dirs[dir] {
+		return
+	}
+	// If a specific directory fails, continue - watch what we can
+	err := w.fs.Add(dir)
+	if err == nil {
+		w.dirs[dir] = true
+		return
+	}
+	// inotify reports its watch limit as ENOSPC, and running out of descriptors (kqueue) as EMFILE
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE) {
+		w.exhausted = true
+	}
+}
+
+// run collects events until the tree has been quiet for debounceDelay, then offers the batch
+// Events arriving before the batch is received are folded into it and delay it again
+func (w *Watcher) run() {
+	var pending *GitChangeMsg
+	paths := make(map[string]bool)
+	var first time.Time
+	var timer <-chan time.Time
+	var out chan GitChangeMsg // Non-nil once the pending batch is ready to send
+
+	for {
+		var ready GitChangeMsg
+		if out != nil {
+			ready = *pending
+			ready.Backend = "fsnotify"
+			for p := range paths {
+				ready.Paths = append(ready.Paths, p)
 			}
+			sort.Strings(ready.Paths)
 		}
 
-		// Wait for first change event
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return nil
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			if pending == nil {
+				pending = &GitChangeMsg{}
+				first = time.Now()
+			}
+			if !w.record(event, pending, paths) {
+				if len(paths) == 0 && !pending.Full {
+					pending = nil
 				}
+				continue
+			}
+			if w.exhausted && w.fallback {
+				// New directories can no longer be watched; poll instead, reloading
+				// everything since events may have been missed
+				w.fs.Close()
+				w.changes <- GitChangeMsg{Full: true, Backend: "poll"}
+				w.poll()
+				return
+			}
+			// The batch is filtered again once the tree is quiet
+			out = nil
+			timer = time.After(min(debounceDelay, time.Until(first.Add(maxDelay))))
+
+		case <-timer:
+			timer = nil
+			w.dropIgnored(paths)
+			if len(paths) == 0 && !pending.Full {
+				// Everything that changed is ignored
+				pending = nil
+				continue
+			}
+			out = w.changes
 
-				// Only trigger on write and create events (ignore chmod, etc.)
-				if event.Op&fsnotify.Write == fsnotify.Write ||
-					event.Op&fsnotify.Create == fsnotify.Create ||
-					event.Op&fsnotify.Remove == fsnotify.Remove ||
-					event.Op&fsnotify.Rename == fsnotify.Rename {
+		case out <- ready:
+			pending = nil
+			paths = make(map[string]bool)
+			out = nil
 
-					// Return immediately on first relevant change
-					// Watcher will be restarted after refresh, providing natural debouncing
-					return GitChangeMsg{}
-				}
+		case _, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
 
-			case _, ok := <-watcher.Errors:
-				if !ok {
-					return nil
+// record adds an event to the pending batch, returning false if it's irrelevant
+func (w *Watcher) record(event fsnotify.Event, pending *GitChangeMsg, paths map[string]bool) bool {
+	// Only write, create, remove and rename events change content (ignore chmod, etc.)
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) &&
+		!event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+		return false
+	}
+
+	dir, name := filepath.Split(event.Name)
+	dir = filepath.Clean(dir)
+
+	if w.gitDirs[dir] || w.gitDirs[event.Name] {
+		// Lock files come and go while git works; the rename onto the real file is what counts
+		if strings.HasSuffix(name, ".lock") {
+			return false
+		}
+		if dir == filepath.Clean(w.ctx.GitDir) {
+			// The git directory holds much more than the index, HEAD and the files
+			// marking a merge, rebase, cherry-pick, revert or bisect in progress
+			if name != "index" && name != "HEAD" && !slices.Contains(repo.StateFiles, name) {
+				return false
+			}
+			// Follow rebase progress while the rebase directory exists
+			if strings.HasPrefix(name, "rebase-") {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.addGitDir(event.Name)
+				} else if w.gitDirs[event.Name] {
+					w.fs.Remove(event.Name)
+					delete(w.gitDirs, event.Name)
 				}
 			}
 		}
+		pending.Full = true
+		return true
+	}
+
+	rel, err := filepath.Rel(w.ctx.Toplevel, event.Name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	// Follow directories as they appear and disappear
+	// A new directory may already hold files and subdirectories (mkdir -p, mv, git checkout)
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+			w.watchTree(rel)
+		}
+	}
+	if (event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)) && w.dirs[event.Name] {
+		w.removeTree(event.Name)
+	}
+
+	switch matchPathspecs(rel, w.pathspecs) {
+	case matchNone:
+		return false
+	case matchParent, matchUnknown:
+		// Re-diffing the path itself would reach beyond the pathspecs, or git has to tell what it covers
+		pending.Full = true
+	}
+
+	// Ignore rules changed: which files are untracked changed too, and directories may no longer be ignored
+	if name == ".gitignore" {
+		pending.Full = true
+		w.watchTree(".")
+	}
+
+	paths[rel] = true
+	return true
+}
+
+// removeTree stops watching a directory that was removed or moved away, and everything below it
+func (w *Watcher) removeTree(dir string) {
+	for watched := range w.dirs {
+		if watched == dir || strings.HasPrefix(watched, dir+string(filepath.Separator)) {
+			w.fs.Remove(watched)
+			delete(w.dirs, watched)
+		}
+	}
+}
+
+// pathspecMatch tells whether a path falls under the pathspecs
+type pathspecMatch int
+
+const (
+	matchNone    pathspecMatch = iota // Outside every pathspec
+	matchPath                         // Inside a pathspec, or no pathspecs were given
+	matchParent                       // A directory containing a pathspec, whose changes reach the pathspec's files
+	matchUnknown                      // A pathspec uses ":" magic or glob characters, which only git can evaluate
+)
+
+// matchPathspecs checks a root-relative path against pathspecs, which match the path itself or everything below it
+// Globs are left to git: in a pathspec "*" also matches "/", so "*.go" covers "src/a.go"
+func matchPathspecs(rel string, pathspecs []string) pathspecMatch {
+	if len(pathspecs) == 0 {
+		return matchPath
+	}
+	result := matchNone
+	for _, spec := range pathspecs {
+		if strings.HasPrefix(spec, ":") || strings.ContainsAny(spec, "*?[\\") {
+			result = matchUnknown
+			continue
+		}
+		spec = strings.TrimSuffix(path.Clean(spec), "/")
+		if spec == "." || rel == spec || strings.HasPrefix(rel, spec+"/") {
+			return matchPath
+		}
+		if strings.HasPrefix(spec, rel+"/") && result == matchNone {
+			result = matchParent
+		}
 	}
+	return result
 }
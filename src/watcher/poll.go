@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gg/src/repo"
+)
+
+// snapshot is the repository state the polling backend compares between checks
+type snapshot struct {
+	index string            // Modification time and size of the index
+	head  string            // Contents of HEAD
+	refs  string            // Every ref with the commit it points to
+	state repo.State        // Operation in progress, such as a merge or rebase
+	paths map[string]string // Status of each changed path, with its modification time and size
+}
+
+// poll checks the repository every interval and reports what changed since the previous check
+// It runs git status, so it works without any file system notifications
+func (w *Watcher) poll() {
+	previous := w.snapshot()
+	for {
+		time.Sleep(w.interval)
+		current := w.snapshot()
+
+		change := GitChangeMsg{Backend: "poll"}
+		change.Full = current.index != previous.index || current.head != previous.head ||
+			current.refs != previous.refs || current.state != previous.state
+		for path, state := range current.paths {
+			if previous.paths[path] != state {
+				change.Paths = append(change.Paths, path)
+			}
+		}
+		for path := range previous.paths {
+			if _, ok := current.paths[path]; !ok {
+				change.Paths = append(change.Paths, path)
+			}
+		}
+		previous = current
+
+		if change.Full || len(change.Paths) > 0 {
+			sort.Strings(change.Paths)
+			w.changes <- change
+		}
+	}
+}
+
+// snapshot reads the state compared by poll
+func (w *Watcher) snapshot() snapshot {
+	snap := snapshot{paths: make(map[string]string)}
+
+	if info, err := os.Stat(w.ctx.GitPath("index")); err == nil {
+		snap.index = fmt.Sprintf("%d %d", info.ModTime().UnixNano(), info.Size())
+	}
+	if head, err := os.ReadFile(w.ctx.GitPath("HEAD")); err == nil {
+		snap.head = string(head)
+	}
+	snap.state = w.ctx.State()
+	if refs, err := w.ctx.Command("for-each-ref", "--format=%(refname) %(objectname)").Output(); err == nil {
+		snap.refs = string(refs)
+	}
+
+	// --no-optional-locks keeps status from rewriting the index, which would look like a change
+	args := []string{"--no-optional-locks", "status", "--porcelain", "-z", "--untracked-files=all"}
+	if len(w.pathspecs) > 0 {
+		args = append(append(args, "--"), w.pathspecs...)
+	}
+	output, err := w.ctx.Command(args...).Output()
+	if err != nil {
+		return snap
+	}
+
+	// Entries are "XY path", followed by the original path for renames and copies
+	// A status line doesn't change when an already modified file is edited again, so the file's stat is included
+	entries := strings.Split(string(output), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		status, path := entry[:2], entry[3:]
+		state := status
+		if info, err := os.Lstat(w.ctx.Path(path)); err == nil {
+			state += fmt.Sprintf(" %d %d", info.ModTime().UnixNano(), info.Size())
+		}
+		snap.paths[path] = state
+
+		if strings.ContainsAny(status, "RC") && i+1 < len(entries) {
+			i++
+			snap.paths[entries[i]] = status
+		}
+	}
+	return snap
+}